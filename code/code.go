@@ -0,0 +1,256 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// Infix operators; the operator itself is the operand, an index into InfixOperators
+	OpInfix
+	// Prefix operators; the operator itself is the operand, an index into PrefixOperators
+	OpPrefix
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJumpNotTruthy
+	OpJump
+	// Short-circuit && and ||: jump to the operand, leaving the value on top of the stack
+	// there, if it is falsy or truthy respectively, and otherwise pop it
+	OpJumpNotTruthyOrPop
+	OpJumpTruthyOrPop
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltIn
+	OpGetFree
+	OpCurrentClosure
+
+	// Assignments store the value on top of the stack into an existing binding, and
+	// leave it there as the value of the assignment expression
+	OpAssignGlobal
+	OpAssignLocal
+	OpAssignFree
+	// Stores into collection[index]; the operand is an index into AssignOperators
+	OpAssignIndex
+
+	// Push a variable for a closure to capture, shared with the enclosing function so
+	// that assignments in either are seen by both
+	OpCaptureLocal
+	OpCaptureFree
+
+	OpArray
+	OpHash
+	OpIndex
+	// Slices the collection below the start, end and step, any of which may be null
+	OpSlice
+
+	OpCall
+	// Calls a method of the receiver below the arguments; the operands are the constant
+	// holding the method's name and the number of arguments
+	OpCallMethod
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	// Replaces the collection on top of the stack with an iterator over it
+	OpIterator
+	// Pushes the next key (with 2 variables) and value of the iterator on top of the
+	// stack, or jumps to the operand once it is exhausted
+	OpIterNext
+
+	// Installs a handler that an error raised before the matching OpEndTry jumps to, the
+	// operand, with the error pushed in place of whatever the guarded code left on the stack
+	OpTry
+	OpEndTry
+	// Replaces the error on top of the stack with the value a catch block binds
+	OpCatch
+	// Raises the value on top of the stack as an error
+	OpThrow
+
+	// Marks the end of a top-level statement that has no value, such as `let`
+	OpClearResult
+)
+
+// Operators are encoded as operands rather than as one opcode each, so the VM can
+// hand them straight to the evaluator's operator semantics and stay in step with it.
+var (
+	InfixOperators = []string{
+		"+", "-", "*", "/", "%", "<", ">", "==", "!=",
+		"**", "<=", ">=", "&", "|", "^", "<<", ">>",
+	}
+	PrefixOperators = []string{"!", "-", "~"}
+	AssignOperators = []string{"=", "+=", "-=", "*=", "/=", "%="}
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // the number of bytes each operand takes up
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpInfix:  {"OpInfix", []int{1}},
+	OpPrefix: {"OpPrefix", []int{1}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltIn:     {"OpGetBuiltIn", []int{2}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpAssignLocal:  {"OpAssignLocal", []int{1}},
+	OpAssignFree:   {"OpAssignFree", []int{1}},
+	OpAssignIndex:  {"OpAssignIndex", []int{1}},
+
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpSlice: {"OpSlice", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpCallMethod:  {"OpCallMethod", []int{2, 1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}}, // constant index, number of free variables
+
+	OpIterator: {"OpIterator", []int{}},
+	OpIterNext: {"OpIterNext", []int{2, 1}}, // jump target, number of loop variables
+
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpCatch:  {"OpCatch", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	OpClearResult: {"OpClearResult", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLength := 1
+	for _, w := range def.OperandWidths {
+		instructionLength += w
+	}
+
+	instruction := make([]byte, instructionLength)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
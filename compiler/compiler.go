@@ -0,0 +1,897 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/token"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	positions           map[int]token.Position // source position of each emitted instruction
+	loops               []*loopLabels          // the loops enclosing the code being compiled
+	handlers            []tryHandler           // the try and finally blocks enclosing it
+}
+
+type loopLabels struct {
+	continueTarget int
+	breakJumps     []int // `OpJump`s to patch with the loop's exit once it is known
+	handlerDepth   int   // the number of handlers enclosing the loop itself
+}
+
+// tryHandler is a try block, whose handler a return, break or continue must remove
+// (running its finally block, if it has one), or a finally block being run, which holds
+// on to the try's value or error on the stack
+type tryHandler struct {
+	finally   *ast.BlockStatement
+	inFinally bool
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	position token.Position // of the node being compiled
+	err      error          // the first operand too large for its instruction
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string // indexed like the globals store, for error messages
+	Positions    map[int]token.Position
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		positions:           map[int]token.Position{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTableWithBuiltIns(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState keeps globals and constants across compilations, as the REPL needs
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// NewSymbolTableWithBuiltIns returns a global symbol table that already knows the standard built-ins
+func NewSymbolTableWithBuiltIns() *SymbolTable {
+	return newSymbolTableWithBuiltIns(evaluator.BuiltInNames())
+}
+
+// NewSymbolTableFor returns a global symbol table that knows the built-ins of in, for
+// bytecode run by a VM made with vm.NewWithInterpreter
+func NewSymbolTableFor(in *evaluator.Interpreter) *SymbolTable {
+	return newSymbolTableWithBuiltIns(in.BuiltInNames())
+}
+
+func newSymbolTableWithBuiltIns(names []string) *SymbolTable {
+	symbolTable := NewSymbolTable()
+	for i, name := range names {
+		symbolTable.DefineBuiltIn(i, name)
+	}
+	return symbolTable
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	if node == nil {
+		return fmt.Errorf("compiler: unsupported node <nil>")
+	}
+
+	outerPosition := c.position
+	c.position = node.Pos()
+	defer func() {
+		c.position = outerPosition
+		if err == nil {
+			err = c.err
+		}
+	}()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+			// Like Eval, statements other than expressions leave the program without a value
+			if _, ok := s.(*ast.ExpressionStatement); !ok {
+				c.emit(code.OpClearResult)
+			}
+		}
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		err := c.compileBoundValue(node.Name.Value, node.Value)
+		if err != nil {
+			return err
+		}
+		c.setVariable(node.Name.Value)
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		err = c.leaveHandlers(0, true)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// Reserve a global slot, so functions can refer to globals defined after them.
+			// Reading it before it is set is a runtime error, as in the evaluator.
+			symbol = c.symbolTable.Global().reserve(node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = object.IntegerFromBig(node.Big)
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		operator := slices.Index(code.PrefixOperators, node.Operator)
+		if operator < 0 {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(code.OpPrefix, operator)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		operator := slices.Index(code.InfixOperators, node.Operator)
+		if operator < 0 {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(code.OpInfix, operator)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		// Map iteration order is random, so sort the keys to emit deterministic bytecode
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		for _, n := range []ast.Expression{node.Left, node.Start, node.End, node.Step} {
+			if n == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			if err := c.Compile(n); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.MethodCallExpression:
+		err := c.Compile(node.Receiver)
+		if err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+		name := c.addConstant(&object.String{Value: node.Method.Value})
+		c.emit(code.OpCallMethod, name, len(node.Arguments))
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of a loop")
+		}
+		err := c.leaveHandlers(loop.handlerDepth, false)
+		if err != nil {
+			return err
+		}
+		loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of a loop")
+		}
+		err := c.leaveHandlers(loop.handlerDepth, false)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.continueTarget)
+	default:
+		return fmt.Errorf("compiler: unsupported node %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Global().Names(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+	}
+}
+
+// compileBoundValue compiles the value of a binding; a function literal learns its own
+// name so it can call itself recursively
+func (c *Compiler) compileBoundValue(name string, value ast.Expression) error {
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		return c.compileFunctionLiteral(fn, name)
+	}
+	return c.Compile(value)
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	// Emit an `OpJumpNotTruthy` with a bogus value, patched once the consequence is compiled
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.Compile(node.Consequence)
+	if err != nil {
+		return err
+	}
+	c.leaveValue()
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		err := c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+		c.leaveValue()
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileLogicalExpression compiles && and ||, which only evaluate their right operand if
+// the left one does not decide the result, and have the value of the operand that did
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jump := code.OpJumpNotTruthyOrPop
+	if node.Operator == "||" {
+		jump = code.OpJumpTruthyOrPop
+	}
+	jumpPos := c.emit(jump, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loopStart := len(c.currentInstructions())
+
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+	exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.compileLoopBody(node.Body, loopStart, func() {
+		c.changeOperand(exitJumpPos, len(c.currentInstructions()))
+	})
+	return err
+}
+
+// The iterator stays on the stack while the loop runs, and is popped on the way out
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	err := c.Compile(node.Collection)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIterator)
+
+	numVariables := 1
+	if node.Key != nil {
+		numVariables = 2
+	}
+
+	loopStart := c.emit(code.OpIterNext, 9999, numVariables)
+	c.setVariable(node.Value.Value)
+	if node.Key != nil {
+		c.setVariable(node.Key.Value)
+	}
+
+	err = c.compileLoopBody(node.Body, loopStart, func() {
+		c.replaceInstruction(loopStart, code.Make(code.OpIterNext, len(c.currentInstructions()), numVariables))
+	})
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// compileLoopBody compiles the body and the jump back to loopStart, then patches the
+// loop's exits, calling patchExit for the loop's own exit jump
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, loopStart int, patchExit func()) error {
+	scope := &c.scopes[c.scopeIndex]
+	loop := &loopLabels{continueTarget: loopStart, handlerDepth: len(scope.handlers)}
+	scope.loops = append(scope.loops, loop)
+
+	err := c.Compile(body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	patchExit()
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) currentLoop() *loopLabels {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// A try with a finally block is compiled as a try/catch guarded by a handler that runs the
+// finally block and rethrows, followed by the finally block for when nothing was thrown
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	if node.Finally == nil {
+		return c.compileTryCatch(node)
+	}
+
+	handlerPos := c.emit(code.OpTry, 9999)
+	c.pushHandler(tryHandler{finally: node.Finally})
+	err := c.compileTryCatch(node)
+	if err != nil {
+		return err
+	}
+	c.popHandler()
+	c.emit(code.OpEndTry)
+
+	err = c.compileFinally(node.Finally)
+	if err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(handlerPos, len(c.currentInstructions()))
+	err = c.compileFinally(node.Finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTryCatch compiles the try block, and the catch block if there is one, leaving
+// the value of whichever ran on the stack
+func (c *Compiler) compileTryCatch(node *ast.TryExpression) error {
+	if node.Catch == nil {
+		err := c.Compile(node.Block)
+		if err != nil {
+			return err
+		}
+		c.leaveValue()
+		return nil
+	}
+
+	catchPos := c.emit(code.OpTry, 9999)
+	c.pushHandler(tryHandler{})
+	err := c.Compile(node.Block)
+	if err != nil {
+		return err
+	}
+	c.leaveValue()
+	c.popHandler()
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(catchPos, len(c.currentInstructions()))
+	c.emit(code.OpCatch)
+	// The catch block has bindings of its own, so the parameter hides a variable of the
+	// same name rather than overwriting it
+	c.symbolTable.EnterBlock()
+	if node.Parameter != nil {
+		c.setVariable(node.Parameter.Value)
+	} else {
+		c.emit(code.OpPop)
+	}
+	err = c.Compile(node.Catch)
+	c.symbolTable.LeaveBlock()
+	if err != nil {
+		return err
+	}
+	c.leaveValue()
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFinally compiles a finally block to run with a value held on the stack
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	c.pushHandler(tryHandler{inFinally: true})
+	err := c.Compile(finally)
+	c.popHandler()
+	return err
+}
+
+// leaveHandlers emits what leaving the try and finally blocks above depth takes,
+// innermost first: each try block's handler is removed and its finally block run. A
+// return discards the stack, but break and continue must pop what finally blocks hold.
+func (c *Compiler) leaveHandlers(depth int, returning bool) error {
+	handlers := c.scopes[c.scopeIndex].handlers
+	for i := len(handlers) - 1; i >= depth; i-- {
+		if handlers[i].inFinally {
+			if !returning {
+				c.emit(code.OpPop)
+			}
+			continue
+		}
+
+		c.emit(code.OpEndTry)
+		if handlers[i].finally == nil {
+			continue
+		}
+
+		// The finally block can only leave the blocks outside it, and appending to this
+		// copy of them must not overwrite the handlers still being compiled
+		c.scopes[c.scopeIndex].handlers = handlers[:i:i]
+		var err error
+		if returning {
+			// the return value is held on the stack meanwhile
+			err = c.compileFinally(handlers[i].finally)
+		} else {
+			err = c.Compile(handlers[i].finally)
+		}
+		c.scopes[c.scopeIndex].handlers = handlers
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) pushHandler(h tryHandler) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers = append(scope.handlers, h)
+}
+
+func (c *Compiler) popHandler() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers = scope.handlers[:len(scope.handlers)-1]
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	operator := slices.Index(code.AssignOperators, node.Operator)
+	if operator < 0 {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			// As when reading it, the global may be defined by the time this runs
+			symbol = c.symbolTable.Global().reserve(target.Value)
+		}
+		if !c.symbolTable.assignable(symbol) {
+			return fmt.Errorf("cannot assign to %s", target.Value)
+		}
+
+		if node.Operator != "=" {
+			c.loadSymbol(symbol)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			infix := slices.Index(code.InfixOperators, strings.TrimSuffix(node.Operator, "="))
+			c.emit(code.OpInfix, infix)
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpAssignLocal, symbol.Index)
+		case FreeScope:
+			c.emit(code.OpAssignFree, symbol.Index)
+		}
+	case *ast.IndexExpression:
+		for _, n := range []ast.Node{target.Left, target.Index, node.Value} {
+			err := c.Compile(n)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpAssignIndex, operator)
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+	return nil
+}
+
+// setVariable binds name, like `let`, to the value on top of the stack
+func (c *Compiler) setVariable(name string) {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+// leaveValue makes a compiled block leave its value on the stack: the trailing `OpPop`
+// of an expression statement is dropped, and a block without one produces null
+func (c *Compiler) leaveValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	localNames := c.symbolTable.Names()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	freeNames := make([]string, len(freeSymbols))
+	for i, s := range freeSymbols {
+		c.captureSymbol(s)
+		freeNames[i] = s.Name
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		NumLocals:     len(localNames),
+		NumParameters: len(node.Parameters),
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+		Positions:     positions,
+		Literal:       node,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltInScope:
+		c.emit(code.OpGetBuiltIn, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// captureSymbol pushes a free variable of the closure being created. Only locals of
+// enclosing functions are free, since globals and built-ins are reachable from anywhere.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].positions[pos] = c.position
+
+	return pos
+}
+
+// checkOperands records an error if an operand does not fit in its width, where Make
+// would wrap it around and the VM would silently use the wrong local, constant or jump
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+	for i, operand := range operands {
+		limit := 1 << (8 * def.OperandWidths[i])
+		if operand < limit {
+			continue
+		}
+		switch {
+		case op == code.OpConstant || (op == code.OpClosure || op == code.OpCallMethod) && i == 0:
+			c.err = fmt.Errorf("too many constants: at most %d allowed", limit)
+		case op == code.OpGetGlobal || op == code.OpSetGlobal || op == code.OpAssignGlobal:
+			c.err = fmt.Errorf("too many global bindings: at most %d allowed", limit)
+		case op == code.OpGetLocal || op == code.OpSetLocal || op == code.OpAssignLocal || op == code.OpCaptureLocal:
+			c.err = fmt.Errorf("too many local bindings: at most %d allowed", limit)
+		case op == code.OpGetFree || op == code.OpAssignFree || op == code.OpCaptureFree:
+			c.err = fmt.Errorf("too many free variables: at most %d allowed", limit)
+		case op == code.OpClosure:
+			c.err = fmt.Errorf("too many free variables: at most %d allowed", limit-1)
+		case op == code.OpGetBuiltIn:
+			c.err = fmt.Errorf("too many built-ins: at most %d allowed", limit)
+		case op == code.OpArray:
+			c.err = fmt.Errorf("too many array elements: at most %d allowed", limit-1)
+		case op == code.OpHash:
+			c.err = fmt.Errorf("too many hash pairs: at most %d allowed", (limit-1)/2)
+		case op == code.OpCall || op == code.OpCallMethod:
+			c.err = fmt.Errorf("too many arguments: at most %d allowed", limit-1)
+		case op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpJumpNotTruthyOrPop ||
+			op == code.OpJumpTruthyOrPop || op == code.OpTry || op == code.OpIterNext:
+			c.err = fmt.Errorf("function or program too long: at most %d bytes of bytecode allowed", limit)
+		default:
+			c.err = fmt.Errorf("operand %d of %s out of range: %d", i, def.Name, operand)
+		}
+		return
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, []int{operand})
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		positions:           map[int]token.Position{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"slices"
+	"strings"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltInScope  SymbolScope = "BUILT_IN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	names []string // of the slots defined so far, by index
+
+	// For each block being compiled, innermost last, the names it has defined and what
+	// they hid; see EnterBlock
+	blocks []map[string]hiddenSymbol
+
+	FreeSymbols []Symbol
+}
+
+type hiddenSymbol struct {
+	symbol Symbol
+	ok     bool // whether there was a symbol to hide
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s, FreeSymbols: []Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this scope. Redefining a name reuses its slot, just as `let`
+// overwrites the existing binding in an object.Environment, unless the name was defined
+// outside the innermost block, which gets a slot of its own.
+func (s *SymbolTable) Define(name string) Symbol {
+	existing, ok := s.store[name]
+	if n := len(s.blocks); n > 0 {
+		if _, defined := s.blocks[n-1][name]; !defined {
+			s.blocks[n-1][name] = hiddenSymbol{symbol: existing, ok: ok}
+			return s.newSlot(name)
+		}
+	}
+	if ok && (existing.Scope == GlobalScope || existing.Scope == LocalScope) {
+		return existing
+	}
+	return s.newSlot(name)
+}
+
+// reserve defines name, which nothing binds yet, for the whole scope, even inside a block
+func (s *SymbolTable) reserve(name string) Symbol {
+	return s.newSlot(name)
+}
+
+func (s *SymbolTable) newSlot(name string) Symbol {
+	symbol := Symbol{Name: name, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// EnterBlock starts a block with bindings of its own, like the enclosed environment the
+// evaluator runs a catch block in: names defined until LeaveBlock get new slots, hiding
+// those outside the block.
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, map[string]hiddenSymbol{})
+}
+
+// LeaveBlock ends the innermost block, so the names it defined refer again to what they
+// did before it
+func (s *SymbolTable) LeaveBlock() {
+	n := len(s.blocks)
+	for name, hidden := range s.blocks[n-1] {
+		if hidden.ok {
+			s.store[name] = hidden.symbol
+		} else {
+			delete(s.store, name)
+		}
+	}
+	s.blocks = s.blocks[:n-1]
+}
+
+func (s *SymbolTable) DefineBuiltIn(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltInScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName lets a function literal bound by `let` refer to itself
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltInScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// assignable reports whether an assignment can rebind symbol. Built-ins are not
+// variables, and a function's own name is the closure being run, not a slot to store into.
+func (s *SymbolTable) assignable(symbol Symbol) bool {
+	switch symbol.Scope {
+	case BuiltInScope, FunctionScope:
+		return false
+	case FreeScope:
+		return s.Outer.assignable(s.FreeSymbols[symbol.Index])
+	}
+	return true
+}
+
+// Global returns the outermost table, where names that are not yet defined are reserved
+func (s *SymbolTable) Global() *SymbolTable {
+	if s.Outer == nil {
+		return s
+	}
+	return s.Outer.Global()
+}
+
+// Names returns the names of the symbols defined in this table, ordered by index, including
+// those of blocks that have ended
+func (s *SymbolTable) Names() []string {
+	return slices.Clone(s.names)
+}
+
+// Symbols returns the symbols defined in this scope, sorted by name
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	slices.SortFunc(symbols, func(a, b Symbol) int { return strings.Compare(a.Name, b.Name) })
+	return symbols
+}
@@ -0,0 +1,159 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestRedefineReusesSlot(t *testing.T) {
+	global := NewSymbolTable()
+	first := global.Define("a")
+	global.Define("b")
+	second := global.Define("a")
+
+	if first != second {
+		t.Errorf("redefinition got a new slot. first=%+v, second=%+v", first, second)
+	}
+	if names := global.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("wrong names. got=%v", names)
+	}
+}
+
+func TestBlockHidesOuterDefinitions(t *testing.T) {
+	global := NewSymbolTable()
+	outer := global.Define("a")
+
+	global.EnterBlock()
+	inner := global.Define("a")
+	if inner == outer {
+		t.Fatalf("a block's definition reused the outer slot %+v", outer)
+	}
+	if again := global.Define("a"); again != inner {
+		t.Errorf("redefinition in the block got a new slot. first=%+v, second=%+v", inner, again)
+	}
+	global.Define("b")
+	global.LeaveBlock()
+
+	if a, ok := global.Resolve("a"); !ok || a != outer {
+		t.Errorf("expected a=%+v after the block, got=%+v", outer, a)
+	}
+	if b, ok := global.Resolve("b"); ok {
+		t.Errorf("b outlived the block that defined it: %+v", b)
+	}
+	if names := global.Names(); len(names) != 3 || names[0] != "a" || names[1] != "a" || names[2] != "b" {
+		t.Errorf("wrong names. got=%v", names)
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	tests := []struct {
+		table           *SymbolTable
+		expectedSymbols []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: FreeScope, Index: 0},
+				{Name: "e", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "c" {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestDefineResolveBuiltIns(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltInScope, Index: 0},
+		{Name: "c", Scope: BuiltInScope, Index: 1},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltIn(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, local} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
@@ -1,15 +1,55 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"interpreter/object"
+	"io"
+	"math"
+	"math/big"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var built_ins map[string]*object.BuiltIn
+// The built-ins that call functions passed to them. Each engine hands them its functions
+// wrapped as built-ins, so they run on that engine.
+var callbackBuiltIns = map[string]bool{
+	"transform": true,
+}
+
+// The built-ins that block, which return early once ctx is done. An evaluation binds them to
+// its own context; called any other way, they run under context.Background().
+var contextBuiltIns = map[string]ContextBuiltInFunction{
+	"sleep": sleep,
+}
+
+// The built-ins making values as large as their arguments ask for, which reserve the bytes
+// with the evaluation's ReserveFunc first. Called any other way, nothing is reserved.
+var reservingBuiltIns = map[string]reservingBuiltInFunction{
+	"concat": concat,
+	"repeat": stringRepeat,
+}
+
+// TakesCallbacks reports whether the standard built-in name calls functions passed to it
+func TakesCallbacks(name string) bool {
+	return standard.TakesCallbacks(name)
+}
+
+// BuiltInNames returns the standard built-in names in a stable order, so compiled code can
+// refer to a built-in by its index.
+func BuiltInNames() []string {
+	return standard.BuiltInNames()
+}
+
+func LookupBuiltIn(name string) (*object.BuiltIn, bool) {
+	return standard.LookupBuiltIn(name)
+}
 
 func init() {
-	built_ins = map[string]*object.BuiltIn{
+	built_ins := map[string]*object.BuiltIn{
 		"len": {
 			Fn: func(args ...object.Object) object.Object {
 				if len(args) != 1 {
@@ -52,33 +92,15 @@ func init() {
 					return newError("argument to `pop` must be an array, but got %s", args[0].Type())
 				}
 				array := args[0].(*object.Array)
+				if len(array.Elements) == 0 {
+					return newError("cannot `pop` from an empty array")
+				}
 				lastElement := array.Elements[len(array.Elements)-1]
 				array.Elements = array.Elements[0 : len(array.Elements)-1]
 
 				return lastElement
 			},
 		},
-		"concat": {
-			Fn: func(args ...object.Object) object.Object {
-				if len(args) != 2 {
-					return newError("wrong number of arguments to `pop`: got %d", len(args))
-				}
-				if args[0].Type() != object.ARRAY_OBJ {
-					return newError("argument 1 to `concat` must be an array, but got %s", args[0].Type())
-				}
-				if args[1].Type() != object.ARRAY_OBJ {
-					return newError("argument 2 to `concat` must be an array, but got %s", args[0].Type())
-				}
-				array1 := args[0].(*object.Array)
-				array2 := args[1].(*object.Array)
-				length := len(array1.Elements) + len(array2.Elements)
-
-				newElements := make([]object.Object, length)
-				copy(newElements, append(array1.Elements, array2.Elements...))
-
-				return &object.Array{Elements: newElements}
-			},
-		},
 		"insert": {
 			Fn: func(args ...object.Object) object.Object {
 				if len(args) != 3 {
@@ -91,8 +113,14 @@ func init() {
 					return newError("argument 2 to `concat` must be an integer, but got %s", args[0].Type())
 				}
 				array := args[0].(*object.Array)
-				index := args[1].(*object.Integer)
+				index, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("index out of range: %s", args[1].Inspect())
+				}
 				value := args[2]
+				if index.Value < 0 || index.Value > int64(len(array.Elements)) {
+					return newError("index out of range: %d", index.Value)
+				}
 
 				return &object.Array{Elements: slices.Insert(array.Elements, int(index.Value), value)}
 
@@ -122,14 +150,20 @@ func init() {
 					return newError("argument to `sort` must be an array, but got %s", args[0].Type())
 				}
 				array := args[0].(*object.Array)
-				for _, obj := range array.Elements {
-					if obj.Type() != object.INTEGER_OBJ {
-						return newError("`sort` currently only supports arrays of integers")
+				// Sorted apart, so an array that cannot be sorted is left as it was
+				sorted := slices.Clone(array.Elements)
+				var err error
+				slices.SortFunc(sorted, func(a, b object.Object) int {
+					order, compareErr := object.Compare(a, b)
+					if compareErr != nil && err == nil {
+						err = compareErr
 					}
-				}
-				slices.SortFunc(array.Elements, func(a, b object.Object) int {
-					return int(a.(*object.Integer).Value) - int(b.(*object.Integer).Value)
+					return order
 				})
+				if err != nil {
+					return newError("cannot `sort`: %s", err)
+				}
+				copy(array.Elements, sorted)
 
 				return &object.Array{Elements: array.Elements}
 
@@ -174,20 +208,228 @@ func init() {
 				newElements := make([]object.Object, 0, len(array.Elements))
 
 				for _, obj := range array.Elements {
-					val := applyFunction(fn, []object.Object{obj})
+					val := callFunction(fn, []object.Object{obj})
+					if isError(val) {
+						return val
+					}
 					newElements = append(newElements, val)
 				}
 
 				return &object.Array{Elements: newElements}
 			},
 		},
-		"print": {
+		"int": {
 			Fn: func(args ...object.Object) object.Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `int`: got %d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.Integer, *object.BigInt:
+					return arg
+				case *object.Float:
+					return floatToInteger(math.Trunc(arg.Value))
+				case *object.String:
+					value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+					if !ok {
+						return newError("cannot convert %q to an integer", arg.Value)
+					}
+					return object.IntegerFromBig(value)
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+		"float": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `float`: got %d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.Integer:
+					return &object.Float{Value: float64(arg.Value)}
+				case *object.BigInt:
+					value, _ := new(big.Float).SetInt(arg.Value).Float64()
+					return &object.Float{Value: value}
+				case *object.Float:
+					return arg
+				case *object.String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("cannot convert %q to a float", arg.Value)
+					}
+					return &object.Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
 				}
-				return NULL
 			},
 		},
+		"round": roundingBuiltIn("round", math.Round),
+		"floor": roundingBuiltIn("floor", math.Floor),
+		"ceil":  roundingBuiltIn("ceil", math.Ceil),
 	}
+
+	for name, fn := range stringBuiltIns {
+		built_ins[name] = fn
+	}
+
+	standard = NewEmptyInterpreter()
+	for name, fn := range built_ins {
+		standard.builtIns[name] = builtIn{BuiltIn: fn, takesCallbacks: callbackBuiltIns[name]}
+	}
+	for name, fn := range contextBuiltIns {
+		standard.RegisterContext(name, fn)
+	}
+	for name, fn := range reservingBuiltIns {
+		standard.builtIns[name] = builtIn{
+			BuiltIn: &object.BuiltIn{
+				Fn: func(args ...object.Object) object.Object {
+					return fn(noReserve, args...)
+				},
+			},
+			withReserve: fn,
+		}
+	}
+	standard.registerStreamBuiltIns()
+}
+
+// The built-ins that use the streams of the interpreter they belong to
+var streamBuiltIns = map[string]func(in *Interpreter) object.BuiltInFunction{
+	"print":    func(in *Interpreter) object.BuiltInFunction { return printTo("print", in.stdout) },
+	"eprint":   func(in *Interpreter) object.BuiltInFunction { return printTo("eprint", in.stderr) },
+	"input":    input,
+	"readline": readline,
+}
+
+// printTo returns a built-in that writes each argument on a line of its own to out()
+func printTo(name string, out func() io.Writer) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		w := out()
+		for _, arg := range args {
+			if _, err := fmt.Fprintln(w, arg.Inspect()); err != nil {
+				return newError("`%s` failed: %s", name, err)
+			}
+		}
+		return NULL
+	}
+}
+
+// input writes an optional prompt and reads a line, without its line break, or NULL at the end of input
+func input(in *Interpreter) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) > 1 {
+			return newError("wrong number of arguments to `input`: got %d", len(args))
+		}
+		if len(args) == 1 {
+			prompt, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `input` must be a string, but got %s", args[0].Type())
+			}
+			if _, err := io.WriteString(in.stdout(), prompt.Value); err != nil {
+				return newError("`input` failed: %s", err)
+			}
+		}
+		return readLine("input", in.stdin())
+	}
+}
+
+// readline reads a line like input, without a prompt
+func readline(in *Interpreter) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `readline`: got %d", len(args))
+		}
+		return readLine("readline", in.stdin())
+	}
+}
+
+func readLine(name string, r *bufio.Reader) object.Object {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("`%s` failed: %s", name, err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return &object.String{Value: strings.TrimSuffix(line, "\r")}
+}
+
+// sleep pauses for a number of milliseconds, at most as long as a time.Duration holds
+func sleep(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `sleep`: got %d", len(args))
+	}
+	if !isNumber(args[0]) {
+		return newError("argument to `sleep` not supported, got %s", args[0].Type())
+	}
+	nanoseconds := toFloat(args[0]) * float64(time.Millisecond)
+	if !(nanoseconds >= 0) {
+		return newError("cannot `sleep` for %s milliseconds", args[0].Inspect())
+	}
+
+	duration := time.Duration(math.MaxInt64)
+	if nanoseconds < math.MaxInt64 {
+		duration = time.Duration(nanoseconds)
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return NULL
+	case <-ctx.Done():
+		return newError("`sleep` interrupted: %s", ctx.Err())
+	}
+}
+
+// roundingBuiltIn returns a built-in that rounds a number to an integer with round
+func roundingBuiltIn(name string, round func(float64) float64) *object.BuiltIn {
+	return &object.BuiltIn{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments to `%s`: got %d", name, len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return arg
+			case *object.Float:
+				return floatToInteger(round(arg.Value))
+			default:
+				return newError("argument to `%s` not supported, got %s", name, args[0].Type())
+			}
+		},
+	}
+}
+
+// floatToInteger converts a whole float, failing for infinities and NaN
+func floatToInteger(value float64) object.Object {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return newError("cannot convert %s to an integer", (&object.Float{Value: value}).Inspect())
+	}
+	whole, _ := big.NewFloat(value).Int(nil)
+	return object.IntegerFromBig(whole)
+}
+
+func concat(reserve ReserveFunc, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `pop`: got %d", len(args))
+	}
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError("argument 1 to `concat` must be an array, but got %s", args[0].Type())
+	}
+	if args[1].Type() != object.ARRAY_OBJ {
+		return newError("argument 2 to `concat` must be an array, but got %s", args[0].Type())
+	}
+	array1 := args[0].(*object.Array)
+	array2 := args[1].(*object.Array)
+	length := len(array1.Elements) + len(array2.Elements)
+	if err := reserve(24 + 16*int64(length)); err != nil {
+		return err
+	}
+
+	newElements := make([]object.Object, length)
+	copy(newElements, array1.Elements)
+	copy(newElements[len(array1.Elements):], array2.Elements)
+
+	return &object.Array{Elements: newElements}
 }
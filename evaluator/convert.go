@@ -0,0 +1,548 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"interpreter/object"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToObject converts a Go value to a Monkey object:
+//
+//   - nil and nil pointers to NULL, and an object.Object to itself
+//   - booleans, integers, floats and strings to the same type; a *big.Int to an integer
+//   - slices and arrays to arrays
+//   - maps to hashes, if their keys convert to integers, strings or booleans
+//   - structs to hashes of their exported fields, keyed by name, or by the name in a
+//     `monkey:"name"` tag; the tag `monkey:"-"` leaves a field out
+//   - funcs to built-ins, which convert their arguments as by FromObject and their
+//     results as by ToObject. A func returning a non-nil error as its last result fails
+//     with its message, and one with several other results returns them as an array.
+//     Monkey functions passed to it run in the evaluation calling it, under its limits.
+//
+// Other values, such as channels and complex numbers, are an error, as is a value that
+// contains itself, such as a slice holding itself as an element.
+func (in *Interpreter) ToObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+	return in.toObject(reflect.ValueOf(value), map[visit]bool{})
+}
+
+// A visit is a Go map, slice or pointer being converted. Meeting one again before it is
+// done means the value contains itself.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// toObject converts v, which is inside the values in path
+func (in *Interpreter) toObject(v reflect.Value, path map[visit]bool) (object.Object, error) {
+	if v.Type().Implements(objectType) && v.Kind() != reflect.Interface {
+		return v.Interface().(object.Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return object.IntegerFromBig(v.Interface().(*big.Int)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if path[key] {
+			return nil, fmt.Errorf("cannot convert Go %s to a Monkey object: it contains itself", v.Type())
+		}
+		path[key] = true
+		defer delete(path, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return boolToBoolObject(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return &object.BigInt{Value: new(big.Int).SetUint64(v.Uint())}, nil
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return in.toObject(v.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			element, err := in.toObject(v.Index(i), path)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := in.toObject(iter.Key(), path)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert Go %s to a Monkey hash: unusable as hash key: %s", v.Type(), key.Type())
+			}
+			value, err := in.toObject(iter.Value(), path)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hash.Pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+		for _, field := range reflect.VisibleFields(v.Type()) {
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			fieldValue, err := v.FieldByIndexErr(field.Index)
+			if err != nil {
+				continue // promoted through a nil embedded pointer
+			}
+			if !fieldValue.CanInterface() {
+				continue // not reachable through its embedded structs
+			}
+			value, err := in.toObject(fieldValue, path)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			key := &object.String{Value: name}
+			hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return in.builtInFromFunc(v), nil
+	default:
+		return nil, fmt.Errorf("cannot convert Go %s to a Monkey object", v.Type())
+	}
+}
+
+// fieldName returns the hash key of a struct field, reporting false for fields left out
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() || field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get("monkey")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// builtInFromFunc wraps a Go func as a built-in. Monkey functions passed to it are called
+// through the engine running the program, or, if Go code calls its Fn, in an evaluation of
+// their own.
+func (in *Interpreter) builtInFromFunc(fn reflect.Value) *object.BuiltIn {
+	t := fn.Type()
+
+	callGo := func(call object.Caller, args ...object.Object) object.Object {
+		fixed := t.NumIn()
+		if t.IsVariadic() {
+			fixed--
+		}
+		if t.IsVariadic() && len(args) < fixed {
+			return newError("wrong number of arguments: want at least %d, got=%d", fixed, len(args))
+		}
+		if !t.IsVariadic() && len(args) != fixed {
+			return newError("wrong number of arguments: want=%d, got=%d", fixed, len(args))
+		}
+
+		params := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i < fixed {
+				paramType = t.In(i)
+			} else {
+				paramType = t.In(fixed).Elem()
+			}
+			param := reflect.New(paramType).Elem()
+			if err := in.fromObject(arg, param, call); err != nil {
+				return newError("argument %d: %s", i+1, err)
+			}
+			params[i] = param
+		}
+
+		out := fn.Call(params)
+
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return newError("%s", err)
+			}
+			out = out[:len(out)-1]
+		}
+
+		results := make([]object.Object, len(out))
+		for i, value := range out {
+			result, err := in.toObject(value, map[visit]bool{})
+			if err != nil {
+				return newError("result %d: %s", i+1, err)
+			}
+			results[i] = result
+		}
+
+		switch len(results) {
+		case 0:
+			return NULL
+		case 1:
+			return results[0]
+		default:
+			return &object.Array{Elements: results}
+		}
+	}
+	return &object.BuiltIn{
+		Fn: func(args ...object.Object) object.Object {
+			return callGo(in.callAlone, args...)
+		},
+		CallbackFn: callGo,
+	}
+}
+
+// FromObject stores obj in the Go value target points to, converting it as ToObject would
+// in reverse. A target of type interface{} gets the natural Go value of obj: an int64,
+// *big.Int, float64, string, bool or nil, a []interface{} for an array, a
+// map[interface{}]interface{} for a hash, or a func(...interface{}) (interface{}, error)
+// for a function. Monkey functions converted to Go funcs run in this interpreter, each call
+// in an evaluation of its own.
+func (in *Interpreter) FromObject(obj object.Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("cannot store a Monkey object in Go %T: not a non-nil pointer", target)
+	}
+	return in.fromObject(obj, v.Elem(), in.callAlone)
+}
+
+// fromObject converts obj into v. Monkey functions converted to Go funcs are run with call.
+func (in *Interpreter) fromObject(obj object.Object, v reflect.Value, call object.Caller) error {
+	t := v.Type()
+	mismatch := func() error {
+		return fmt.Errorf("cannot convert Monkey %s to Go %s", obj.Type(), t)
+	}
+
+	if t.Kind() != reflect.Interface && reflect.TypeOf(obj).AssignableTo(t) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if t == bigIntType {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			v.Set(reflect.ValueOf(big.NewInt(obj.Value)))
+		case *object.BigInt:
+			v.Set(reflect.ValueOf(new(big.Int).Set(obj.Value)))
+		case *object.Null:
+			v.Set(reflect.Zero(t))
+		default:
+			return mismatch()
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			// such as object.Object itself
+			if !reflect.TypeOf(obj).Implements(t) {
+				return mismatch()
+			}
+			v.Set(reflect.ValueOf(obj))
+			return nil
+		}
+		value, err := in.goValue(obj, call)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(boolean.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			if obj.Type() == object.INTEGER_OBJ {
+				return fmt.Errorf("cannot convert Monkey %s to Go %s: out of range", obj.Inspect(), t)
+			}
+			return mismatch()
+		}
+		if v.OverflowInt(integer.Value) {
+			return fmt.Errorf("cannot convert Monkey %d to Go %s: out of range", integer.Value, t)
+		}
+		v.SetInt(integer.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var value *big.Int
+		switch obj := obj.(type) {
+		case *object.Integer:
+			value = big.NewInt(obj.Value)
+		case *object.BigInt:
+			value = obj.Value
+		default:
+			return mismatch()
+		}
+		if !value.IsUint64() || v.OverflowUint(value.Uint64()) {
+			return fmt.Errorf("cannot convert Monkey %s to Go %s: out of range", value, t)
+		}
+		v.SetUint(value.Uint64())
+	case reflect.Float32, reflect.Float64:
+		if !isNumber(obj) {
+			return mismatch()
+		}
+		v.SetFloat(toFloat(obj))
+	case reflect.String:
+		str, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(str.Value)
+	case reflect.Pointer:
+		if obj == NULL {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		elem := reflect.New(t.Elem())
+		if err := in.fromObject(obj, elem.Elem(), call); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice, reflect.Array:
+		if obj == NULL && t.Kind() == reflect.Slice {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch()
+		}
+		if t.Kind() == reflect.Array && len(array.Elements) != t.Len() {
+			return fmt.Errorf("cannot convert Monkey array of length %d to Go %s", len(array.Elements), t)
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+		}
+		for i, element := range array.Elements {
+			if err := in.fromObject(element, v.Index(i), call); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		if obj == NULL {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key := reflect.New(t.Key()).Elem()
+			if err := in.fromObject(pair.Key, key, call); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := in.fromObject(pair.Value, value, call); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch()
+		}
+		for _, field := range reflect.VisibleFields(t) {
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			value := hashField(hash, name)
+			if value == nil {
+				continue
+			}
+			fieldValue, err := v.FieldByIndexErr(field.Index)
+			if err != nil {
+				continue // promoted through a nil embedded pointer
+			}
+			if !fieldValue.CanSet() {
+				continue // not reachable through its embedded structs
+			}
+			if err := in.fromObject(value, fieldValue, call); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+	case reflect.Func:
+		if obj.Type() != object.FUNCTION_OBJ && obj.Type() != object.BUILT_IN_OBJ {
+			return mismatch()
+		}
+		v.Set(in.funcFromFunction(obj, t, call))
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// goValue returns the natural Go value of obj, see FromObject
+func (in *Interpreter) goValue(obj object.Object, call object.Caller) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := in.goValue(element, call)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *object.Hash:
+		values := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := in.goValue(pair.Key, call)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := pair.Key.(*object.BigInt); ok {
+				// *big.Int keys would compare by pointer
+				key = pair.Key.Inspect()
+			}
+			value, err := in.goValue(pair.Value, call)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			values[key] = value
+		}
+		return values, nil
+	case *object.Function, *object.Closure, *object.BuiltIn:
+		return func(args ...interface{}) (interface{}, error) {
+			result, err := in.callWith(call, obj, args)
+			if err != nil {
+				return nil, err
+			}
+			return in.goValue(result, call)
+		}, nil
+	default:
+		return nil, fmt.Errorf("cannot convert Monkey %s to a Go value", obj.Type())
+	}
+}
+
+// funcFromFunction wraps a Monkey function as a Go func of type t. Its arguments are
+// converted as by ToObject and its result as by FromObject into t's first result. If t's
+// last result is an error, it reports what the call failed with; otherwise the func panics.
+// The function is run with call.
+func (in *Interpreter) funcFromFunction(fn object.Object, t reflect.Type, call object.Caller) reflect.Value {
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, t.NumOut())
+		for i := range results {
+			results[i] = reflect.New(t.Out(i)).Elem()
+		}
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				panic(err)
+			}
+			results[len(results)-1].Set(reflect.ValueOf(&err).Elem())
+			return results
+		}
+
+		if t.IsVariadic() {
+			variadic := args[len(args)-1]
+			args = args[:len(args)-1]
+			for i := 0; i < variadic.Len(); i++ {
+				args = append(args, variadic.Index(i))
+			}
+		}
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg.Interface()
+		}
+
+		result, err := in.callWith(call, fn, values)
+		if err != nil {
+			return fail(err)
+		}
+		if t.NumOut() > 0 && !(returnsError && t.NumOut() == 1) {
+			if err := in.fromObject(result, results[0], call); err != nil {
+				return fail(err)
+			}
+		}
+		return results
+	})
+}
+
+// callWith calls the Monkey function fn with call, converting args as by ToObject. An error
+// the function fails with is returned as an *object.Error.
+func (in *Interpreter) callWith(call object.Caller, fn object.Object, args []interface{}) (object.Object, error) {
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := in.ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		objects[i] = obj
+	}
+
+	return splitError(call(fn, objects))
+}
+
+// callAlone calls fn in an evaluation of its own, for Go code running it outside of any
+func (in *Interpreter) callAlone(fn object.Object, args []object.Object) object.Object {
+	return in.call(context.Background(), fn, args)
+}
@@ -0,0 +1,403 @@
+package evaluator
+
+import (
+	"errors"
+	"interpreter/object"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `monkey:"label"`
+	Hidden string `monkey:"-"`
+	secret int
+}
+
+type listNode struct {
+	Next *listNode
+}
+
+type inner struct {
+	Name  string
+	Count *big.Int
+	Print func()
+}
+
+type outer struct {
+	inner
+	Label string
+}
+
+func TestToObject(t *testing.T) {
+	in := NewInterpreter()
+	shared := []int{1}
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{big.NewInt(7), "7"},
+		{1.5, "1.5"},
+		{"hello", "hello"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{point{X: 1, Y: 2, Label: "p", Hidden: "h"}, ""},
+		{&object.Integer{Value: 5}, "5"},
+		{(*int)(nil), "null"},
+		{[][]int{shared, shared}, "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		obj, err := in.ToObject(tt.value)
+		if err != nil {
+			t.Errorf("%#v: unexpected error %s", tt.value, err)
+			continue
+		}
+		if tt.expected == "" {
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: expected %s, got=%s", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	obj, _ := in.ToObject(point{X: 1, Y: 2, Label: "p", Hidden: "h"})
+	hash := obj.(*object.Hash)
+	if len(hash.Pairs) != 3 {
+		t.Errorf("expected 3 fields, got=%s", hash.Inspect())
+	}
+	testIntegerObject(t, hashField(hash, "X"), 1)
+	if label, ok := hashField(hash, "label").(*object.String); !ok || label.Value != "p" {
+		t.Errorf("expected label p, got=%v", hashField(hash, "label"))
+	}
+}
+
+func TestToObjectErrors(t *testing.T) {
+	in := NewInterpreter()
+
+	slice := []interface{}{1, nil}
+	slice[1] = slice
+	hash := map[string]interface{}{}
+	hash["self"] = hash
+	list := &listNode{}
+	list.Next = list
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{make(chan int), "cannot convert Go chan int to a Monkey object"},
+		{complex(1, 2), "cannot convert Go complex128 to a Monkey object"},
+		{[]interface{}{1, make(chan int)}, "index 1: cannot convert Go chan int to a Monkey object"},
+		{map[[2]int]int{{1, 2}: 3}, "cannot convert Go map[[2]int]int to a Monkey hash: unusable as hash key: ARRAY"},
+		{slice, "index 1: cannot convert Go []interface {} to a Monkey object: it contains itself"},
+		{hash, "key self: cannot convert Go map[string]interface {} to a Monkey object: it contains itself"},
+		{list, "field Next: cannot convert Go *evaluator.listNode to a Monkey object: it contains itself"},
+	}
+
+	for _, tt := range tests {
+		_, err := in.ToObject(tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%T: expected error %q, got=%v", tt.value, tt.expected, err)
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	in := NewInterpreter()
+
+	var i int
+	var u8 uint8
+	var f float64
+	var s string
+	var b bool
+	var ints []int
+	var counts map[string]int
+	var p point
+	var ptr *int
+	var n *big.Int
+	var obj object.Object
+	var value interface{}
+
+	tests := []struct {
+		source   string
+		target   interface{}
+		expected interface{}
+	}{
+		{"42", &i, 42},
+		{"200", &u8, uint8(200)},
+		{"1.5", &f, 1.5},
+		{"2", &f, 2.0},
+		{`"hi"`, &s, "hi"},
+		{"true", &b, true},
+		{"[1, 2, 3]", &ints, []int{1, 2, 3}},
+		{`{"a": 1, "b": 2}`, &counts, map[string]int{"a": 1, "b": 2}},
+		{`{"X": 1, "Y": 2, "label": "p", "Hidden": "h", "other": 3}`, &p, point{X: 1, Y: 2, Label: "p"}},
+		{"5", &ptr, 5},
+		{"9223372036854775807 + 1", &n, "9223372036854775808"},
+		{"[1, 2]", &obj, "[1, 2]"},
+		{`[1, "a", true, if (false) { 1 }, 1.5]`, &value, []interface{}{int64(1), "a", true, nil, 1.5}},
+		{`{1: [2]}`, &value, map[interface{}]interface{}{int64(1): []interface{}{int64(2)}}},
+	}
+
+	for _, tt := range tests {
+		result, err := in.EvalString(tt.source)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.source, err)
+		}
+		if err := in.FromObject(result, tt.target); err != nil {
+			t.Errorf("%s: unexpected error %s", tt.source, err)
+			continue
+		}
+
+		actual := reflect.ValueOf(tt.target).Elem().Interface()
+		switch actual := actual.(type) {
+		case *int:
+			if *actual != tt.expected {
+				t.Errorf("%s: expected %v, got=%v", tt.source, tt.expected, *actual)
+			}
+		case *big.Int:
+			if actual.String() != tt.expected {
+				t.Errorf("%s: expected %v, got=%v", tt.source, tt.expected, actual)
+			}
+		case object.Object:
+			if actual.Inspect() != tt.expected {
+				t.Errorf("%s: expected %v, got=%v", tt.source, tt.expected, actual)
+			}
+		default:
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("%s: expected %#v, got=%#v", tt.source, tt.expected, actual)
+			}
+		}
+	}
+}
+
+// Exported fields promoted through an unexported embedded struct convert like the others,
+// without reflection refusing to read or set them; the embedded struct itself is left out
+func TestUnexportedEmbeddedFields(t *testing.T) {
+	in := NewInterpreter()
+
+	obj, err := in.ToObject(outer{inner: inner{Name: "n", Count: big.NewInt(1), Print: func() {}}, Label: "l"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := obj.(*object.Hash)
+	if len(hash.Pairs) != 4 || hashField(hash, "inner") != nil {
+		t.Errorf("expected the promoted fields and Label, got=%s", hash.Inspect())
+	}
+	testIntegerObject(t, hashField(hash, "Count"), 1)
+	if hashField(hash, "Print").Type() != object.BUILT_IN_OBJ {
+		t.Errorf("expected Print to be a built-in, got=%s", hashField(hash, "Print").Type())
+	}
+
+	obj, err = in.ToObject(struct {
+		*inner
+		Label string
+	}{inner: &inner{Name: "p"}, Label: "l"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := hashField(obj.(*object.Hash), "Name").(*object.String); !ok || name.Value != "p" {
+		t.Errorf("expected Name through the embedded pointer, got=%s", obj.Inspect())
+	}
+
+	source, err := in.EvalString(`{"Name": "m", "Count": 2, "Label": "k"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var target outer
+	if err := in.FromObject(source, &target); err != nil {
+		t.Fatal(err)
+	}
+	if target.Label != "k" || target.Name != "m" || target.Count.Int64() != 2 {
+		t.Errorf("expected the promoted fields set, got=%+v", target)
+	}
+}
+
+func TestFromObjectErrors(t *testing.T) {
+	in := NewInterpreter()
+
+	var i int
+	var i8 int8
+	var u uint
+	var s string
+	var ints []int
+	var pair [2]int
+
+	tests := []struct {
+		source   string
+		target   interface{}
+		expected string
+	}{
+		{`"a"`, &i, "cannot convert Monkey STRING to Go int"},
+		{"300", &i8, "cannot convert Monkey 300 to Go int8: out of range"},
+		{"-1", &u, "cannot convert Monkey -1 to Go uint: out of range"},
+		{"9223372036854775807 + 1", &i, "cannot convert Monkey 9223372036854775808 to Go int: out of range"},
+		{"1", &s, "cannot convert Monkey INTEGER to Go string"},
+		{`[1, "a"]`, &ints, "index 1: cannot convert Monkey STRING to Go int"},
+		{"[1, 2, 3]", &pair, "cannot convert Monkey array of length 3 to Go [2]int"},
+		{"1", i, "cannot store a Monkey object in Go int: not a non-nil pointer"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.EvalString(tt.source)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.source, err)
+		}
+		err = in.FromObject(result, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got=%v", tt.source, tt.expected, err)
+		}
+	}
+}
+
+func TestEmbedding(t *testing.T) {
+	in := NewInterpreter()
+
+	if err := in.SetGlobal("greeting", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetGlobal("shout", strings.ToUpper); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetGlobal("divide", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("cannot divide by zero")
+		}
+		return a / b, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := in.EvalString(`let add = fn(a, b) { a + b }; let loud = shout(greeting); loud`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpectedObject(t, "loud", result, "HELLO")
+
+	result, err = in.EvalString("let x = 1;")
+	if err != nil || result != NULL {
+		t.Errorf("expected NULL for a let statement, got=%v (%v)", result, err)
+	}
+
+	add, ok := in.Global("add")
+	if !ok {
+		t.Fatal("add is not defined")
+	}
+	result, err = in.Call(add, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, result, 5)
+
+	var addFunc func(int, int) (int, error)
+	if err := in.FromObject(add, &addFunc); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := addFunc(4, 5); err != nil || sum != 9 {
+		t.Errorf("expected 9, got=%d (%v)", sum, err)
+	}
+
+	_, err = in.Call(add, "a", 1)
+	var errObj *object.Error
+	if !errors.As(err, &errObj) || errObj.Message != "type mismatch: STRING + INTEGER" {
+		t.Errorf("expected a Monkey error, got=%v", err)
+	}
+
+	_, err = in.EvalString("divide(1, 0)")
+	if !errors.As(err, &errObj) || errObj.Message != "cannot divide by zero" {
+		t.Errorf("expected the Go error, got=%v", err)
+	}
+	result, err = in.EvalString("divide(7, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, result, 3)
+
+	_, err = in.EvalString("divide(1)")
+	if err == nil || err.Error() != "1:7: wrong number of arguments: want=2, got=1" {
+		t.Errorf("expected an argument count error, got=%v", err)
+	}
+
+	if err := in.SetGlobal("joinWith", func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = in.EvalString(`joinWith("-", "a", "b")`)
+	if err != nil || result.Inspect() != "a-b" {
+		t.Errorf("expected a-b, got=%v (%v)", result, err)
+	}
+	_, err = in.EvalString("joinWith()")
+	if err == nil || err.Error() != "1:9: wrong number of arguments: want at least 1, got=0" {
+		t.Errorf("expected an argument count error, got=%v", err)
+	}
+
+	_, err = in.EvalString("let = 1;")
+	if err == nil || !strings.Contains(err.Error(), "expected next token to be IDENT") {
+		t.Errorf("expected a syntax error, got=%v", err)
+	}
+
+	_, err = in.Call(add, make(chan int))
+	if err == nil || err.Error() != "argument 1: cannot convert Go chan int to a Monkey object" {
+		t.Errorf("expected a conversion error, got=%v", err)
+	}
+}
+
+func TestGoCallbacksRunUnderLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          Limits
+		expectedKind    string
+		expectedMessage string
+	}{
+		{"each(1000000, fn(i) { i })", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"try { each(1000000, fn(i) { i }) } catch (e) { e }", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"check(fn() { while (true) { } })", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"sum([fn() { while (true) { } }])", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"let f = fn(n) { apply(f, n) }; f(0)", Limits{MaxCallDepth: 50}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 50 exceeded"},
+	}
+
+	for _, tt := range tests {
+		in := NewInterpreter()
+		in.Limits = tt.limits
+		globals := map[string]interface{}{
+			"each": func(n int, f func(int)) {
+				for i := 0; i < n; i++ {
+					f(i)
+				}
+			},
+			"check": func(f func() error) error { return f() },
+			"sum": func(fs []func() int) int {
+				total := 0
+				for _, f := range fs {
+					total += f()
+				}
+				return total
+			},
+			"apply": func(f func(int) int, n int) int { return f(n + 1) },
+		}
+		for name, value := range globals {
+			if err := in.SetGlobal(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := in.EvalString(tt.input)
+		var errObj *object.Error
+		if !errors.As(err, &errObj) || errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: expected %s error %q, got=%v", tt.input, tt.expectedKind, tt.expectedMessage, err)
+		}
+	}
+}
@@ -1,112 +1,458 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"interpreter/ast"
 	"interpreter/object"
+	"interpreter/token"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// evaluation is the state of a single call to Eval
+type evaluation struct {
+	ctx  context.Context
+	done <-chan struct{} // ctx.Done(), which is nil if ctx cannot be cancelled
+
+	builtIns map[string]builtIn
+
+	limits   Limits
+	steps    int64 // nodes evaluated so far
+	depth    int   // Monkey function calls in progress
+	objects  int64 // objects allocated so far, and their approximate size
+	bytes    int64
+	deadline time.Time
+
+	// The limit error once one is exceeded; it aborts the evaluation, uncaught by try
+	aborted *object.Error
+}
+
+// Eval evaluates a program, or any other node, in env. A panic is a bug in the interpreter,
+// but it must not take down a program embedding it, so it is returned as an error instead.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContextWithLimits(context.Background(), node, env, Limits{})
+}
+
+// EvalContext is Eval, aborting with an error once ctx is done. It is checked on every
+// function call and loop iteration, and blocking built-ins such as `sleep` return early.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return EvalContextWithLimits(ctx, node, env, Limits{})
+}
+
+// EvalWithLimits is Eval, failing with an error once the evaluation exceeds limits
+func EvalWithLimits(node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return EvalContextWithLimits(context.Background(), node, env, limits)
+}
+
+// EvalContextWithLimits is Eval with both a context and limits
+func EvalContextWithLimits(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return standard.eval(ctx, node, env, limits)
+}
+
+// newEvaluation starts an evaluation under ctx and limits. The timeout is a deadline on its
+// context too, so blocking built-ins such as `sleep` return once it passes; the function
+// returned releases that context, once the evaluation is over.
+func newEvaluation(ctx context.Context, interpreter *Interpreter, limits Limits) (*evaluation, context.CancelFunc) {
+	if limits.MaxCallDepth == 0 {
+		limits.MaxCallDepth = DefaultMaxCallDepth
+	}
+	cancel := context.CancelFunc(func() {})
+	var deadline time.Time
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	e := &evaluation{ctx: ctx, done: ctx.Done(), builtIns: interpreter.builtIns, limits: limits, deadline: deadline}
+	return e, cancel
+}
+
+func (e *evaluation) evalNode(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+
+	result := e.eval(node, env)
+	if e.limitsAllocations() && allocates(node) {
+		if err := e.allocate(result); err != nil {
+			return err
+		}
+	}
+
+	// Errors bubble up through every enclosing node; the innermost one, whose evaluation
+	// actually failed, is the position to report
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.evalNode(node.Expression, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return object.IntegerFromBig(node.Big)
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return boolToBoolObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.evalNode(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.evalNode(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			// Short-circuit, leaving the value of the operand that decided the result
+			if isTruthy(left) == (node.Operator == "||") {
+				return left
+			}
+			return e.evalNode(node.Right, env)
+		}
+		right := e.evalNode(node.Right, env)
 		if isError(right) {
 			return right
 		}
+		if err := e.reserve(InfixSize(node.Operator, left, right)); err != nil {
+			return err
+		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.evalNode(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.evalNode(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			val.(*object.Function).Name = node.Name.Value
+		}
 		env.Set(node.Name.Value, val)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Env: env, Body: body}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.evalNode(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, node.Pos())
+	case *ast.MethodCallExpression:
+		receiver := e.evalNode(node.Receiver, env)
+		if isError(receiver) {
+			return receiver
+		}
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return e.callMethod(receiver, node.Method.Value, args)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.evalNode(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.evalNode(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		operands := []object.Object{NULL, NULL, NULL, NULL}
+		for i, operand := range []ast.Expression{node.Left, node.Start, node.End, node.Step} {
+			if operand == nil {
+				continue
+			}
+			if operands[i] = e.evalNode(operand, env); isError(operands[i]) {
+				return operands[i]
+			}
+		}
+		if e.limits.MaxAllocatedBytes > 0 {
+			if err := e.reserve(SliceSize(operands[0], operands[1], operands[2], operands[3])); err != nil {
+				return err
+			}
+		}
+		return evalSliceExpression(operands[0], operands[1], operands[2], operands[3])
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+	case *ast.ThrowStatement:
+		val := e.evalNode(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return Thrown(val)
 	}
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// The exported operations below let the bytecode VM share the evaluator's semantics,
+// so both engines produce the same objects and error messages.
+
+func ApplyPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func ApplyInfix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func ApplyIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// ApplySlice slices left[start:end:step], where a bound left out is null
+func ApplySlice(left, start, end, step object.Object) object.Object {
+	return evalSliceExpression(left, start, end, step)
+}
+
+// ApplyIndexAssignment stores value into left[index] for an assignment operator such as
+// "=" or "+=", returning the value stored
+func ApplyIndexAssignment(operator string, left, index, value object.Object) object.Object {
+	return evalIndexAssignment(operator, left, index, value)
+}
+
+func BuildHash(keys, values []object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, key := range keys {
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: values[i]}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func Iterate(collection object.Object) object.Object {
+	return newIterator(collection)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// CaughtValue is what a catch block sees of err: a hash of its "message" and "kind", and
+// the "file", "line" and "column" it was raised at
+func CaughtValue(err *object.Error) object.Object {
+	fields := map[string]object.Object{
+		"message": &object.String{Value: err.Message},
+		"kind":    &object.String{Value: err.Kind},
+		"file":    &object.String{Value: err.Pos.Filename},
+		"line":    &object.Integer{Value: int64(err.Pos.Line)},
+		"column":  &object.Integer{Value: int64(err.Pos.Column)},
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for name, value := range fields {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// Thrown turns the value of a throw statement into the error it raises. A string is the
+// message; a hash supplies whichever fields a caught error has, so rethrowing a caught
+// error raises it again unchanged; anything else is described by its Inspect.
+func Thrown(value object.Object) *object.Error {
+	switch value := value.(type) {
+	case *object.Error:
+		return value
+	case *object.String:
+		return &object.Error{Message: value.Value, Kind: object.ERROR_KIND}
+	case *object.Hash:
+		err := &object.Error{Message: value.Inspect(), Kind: object.ERROR_KIND}
+		if message, ok := hashField(value, "message").(*object.String); ok {
+			err.Message = message.Value
+		}
+		if kind, ok := hashField(value, "kind").(*object.String); ok && kind.Value != "" {
+			err.Kind = kind.Value
+		}
+		if file, ok := hashField(value, "file").(*object.String); ok {
+			err.Pos.Filename = file.Value
+		}
+		if line, ok := hashField(value, "line").(*object.Integer); ok {
+			err.Pos.Line = int(line.Value)
+		}
+		if column, ok := hashField(value, "column").(*object.Integer); ok {
+			err.Pos.Column = int(column.Value)
+		}
+		return err
+	default:
+		return &object.Error{Message: value.Inspect(), Kind: object.ERROR_KIND}
+	}
+}
+
+func hashField(hash *object.Hash, name string) object.Object {
+	pair, ok := hash.Pairs[(&object.String{Value: name}).HashKey()]
+	if !ok {
+		return nil
+	}
+	return pair.Value
+}
+
+// applyFunction calls fn from callSite, which is invalid when a built-in calls it. An error
+// raised by a Monkey function records the call in its stack as it unwinds.
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object, callSite token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) < len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		if err := e.checkCancelled(); err != nil {
+			return err
+		}
+		if e.depth >= e.limits.MaxCallDepth {
+			return e.abort(object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of %d exceeded", e.limits.MaxCallDepth)
+		}
+
+		e.depth++
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		evaluated := e.evalNode(fn.Body, extendedEnv)
+		e.depth--
+
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.StackFrame{Function: fn.Name, CallPos: callSite})
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.BuiltIn:
+		if fn.CallbackFn != nil {
+			return e.applyCallbackBuiltIn(fn, args)
+		}
 		return fn.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// applyCallbackBuiltIn calls a built-in that runs the functions it is given in this
+// evaluation. If one exceeds a limit, the evaluation ends with that error, however the
+// built-in reports it, even by panicking.
+func (e *evaluation) applyCallbackBuiltIn(fn *object.BuiltIn, args []object.Object) (result object.Object) {
+	defer func() {
+		if e.aborted != nil {
+			recover()
+			result = e.aborted
+		}
+	}()
+
+	return fn.CallbackFn(func(fn object.Object, args []object.Object) object.Object {
+		return e.applyFunction(fn, args, token.Position{})
+	}, args...)
+}
+
+// callFunction calls fn on behalf of a built-in. An evaluation hands callback built-ins
+// its functions wrapped as built-ins (see wrapCallbacks), so a bare function only arrives
+// here if Go code calls the built-in directly, and it is run in an evaluation of its own.
+func callFunction(fn object.Object, args []object.Object) object.Object {
+	e, cancel := newEvaluation(context.Background(), standard, Limits{})
+	defer cancel()
+	return e.applyFunction(fn, args, token.Position{})
+}
+
+// bindBuiltIn ties the built-ins that need it to this evaluation: those taking callbacks
+// run them here, those that block return once the evaluation is cancelled, and those
+// making values as large as their arguments ask for reserve the bytes here
+func (e *evaluation) bindBuiltIn(fn builtIn) *object.BuiltIn {
+	if fn.takesCallbacks {
+		return e.wrapCallbacks(fn.BuiltIn)
+	}
+	if fn.withReserve != nil {
+		return fn.bind(e.ctx, e.reserve)
+	}
+	if fn.withContext != nil {
+		return &object.BuiltIn{
+			Fn: func(args ...object.Object) object.Object {
+				result := fn.withContext(e.ctx, args...)
+				if err := e.checkCancelled(); err != nil {
+					return err
+				}
+				return result
+			},
+		}
+	}
+	return fn.BuiltIn
+}
+
+// wrapCallbacks lets a built-in call functions back within this evaluation, under its
+// limits: Function arguments are handed to it as built-ins that apply the function here
+func (e *evaluation) wrapCallbacks(builtIn *object.BuiltIn) *object.BuiltIn {
+	return &object.BuiltIn{
+		Fn: func(args ...object.Object) object.Object {
+			wrapped := make([]object.Object, len(args))
+			for i, arg := range args {
+				if fn, ok := arg.(*object.Function); ok {
+					wrapped[i] = &object.BuiltIn{
+						Fn: func(args ...object.Object) object.Object {
+							return e.applyFunction(fn, args, token.Position{})
+						},
+					}
+				} else {
+					wrapped[i] = arg
+				}
+			}
+			return builtIn.Fn(wrapped...)
+		},
+	}
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIndex, param := range fn.Parameters {
@@ -123,11 +469,11 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluation) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range expressions {
-		evaluated := Eval(e, env)
+	for _, expression := range expressions {
+		evaluated := e.evalNode(expression, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -136,11 +482,11 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return result
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.evalNode(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -152,15 +498,15 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.evalNode(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -176,7 +522,7 @@ func boolToBoolObject(input bool) *object.Boolean {
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: object.RUNTIME_ERROR_KIND}
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
@@ -185,11 +531,24 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalNegationOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitwiseNotOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
+func evalBitwiseNotOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return object.IntegerFromBig(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
+}
+
 func evalNegationOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -204,11 +563,19 @@ func evalNegationOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.IntegerFromBig(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.IntegerFromBig(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(
@@ -218,36 +585,201 @@ func evalInfixExpression(
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// one of them is a float, so the integer is promoted
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return boolToBoolObject(left == right)
+		return boolToBoolObject(object.Equal(left, right))
 	case operator == "!=":
-		return boolToBoolObject(left != right)
+		return boolToBoolObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == object.ARRAY_OBJ && isOrdering(operator):
+		return evalOrdering(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalIntegerInfixExpression works on int64s where it can, and on big.Ints once either
+// operand is a BigInt or the result would overflow
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+	leftInteger, leftOk := left.(*object.Integer)
+	rightInteger, rightOk := right.(*object.Integer)
+	if !leftOk || !rightOk {
+		return evalBigIntegerInfixExpression(operator, left, right)
+	}
+	leftVal := leftInteger.Value
+	rightVal := rightInteger.Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		if (rightVal > 0 && sum < leftVal) || (rightVal < 0 && sum > leftVal) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		difference := leftVal - rightVal
+		if (rightVal > 0 && difference > leftVal) || (rightVal < 0 && difference < leftVal) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: difference}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		product := leftVal * rightVal
+		if leftVal != 0 && (product/leftVal != rightVal || (leftVal == -1 && rightVal == math.MinInt64)) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: product}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		// Like /, truncates towards zero, so the remainder has the sign of leftVal
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**", "<<":
+		return evalBigIntegerInfixExpression(operator, left, right)
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<":
+		return boolToBoolObject(leftVal < rightVal)
+	case ">":
+		return boolToBoolObject(leftVal > rightVal)
+	case "<=":
+		return boolToBoolObject(leftVal <= rightVal)
+	case ">=":
+		return boolToBoolObject(leftVal >= rightVal)
+	case "!=":
+		return boolToBoolObject(leftVal != rightVal)
+	case "==":
+		return boolToBoolObject(leftVal == rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// maxIntegerBits bounds the integers ** and << make, which could otherwise ask for more
+// memory than there is in a single step
+const maxIntegerBits = 1 << 24
+
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.BigValue(left)
+	rightVal, _ := object.BigValue(right)
+
+	switch operator {
+	case "+":
+		return object.IntegerFromBig(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return object.IntegerFromBig(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return object.IntegerFromBig(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Quo truncates towards zero, like int64 division
+		return object.IntegerFromBig(new(big.Int).Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.IntegerFromBig(new(big.Int).Rem(leftVal, rightVal))
+	case "**":
+		if rightVal.Sign() < 0 {
+			// A negative power is a fraction
+			return evalFloatInfixExpression(operator, left, right)
+		}
+		// Powers of 0, 1 and -1 stay small however large the exponent
+		if leftVal.CmpAbs(big.NewInt(1)) > 0 &&
+			(!rightVal.IsInt64() || rightVal.Int64() > maxIntegerBits/int64(leftVal.BitLen())) {
+			return newError("integer too large: %s ** %s", leftVal, rightVal)
+		}
+		return object.IntegerFromBig(new(big.Int).Exp(leftVal, rightVal, nil))
+	case "<<", ">>":
+		if rightVal.Sign() < 0 {
+			return newError("negative shift count: %s", rightVal)
+		}
+		if operator == ">>" {
+			if !rightVal.IsInt64() {
+				// Every bit is shifted out, leaving only the sign
+				return &object.Integer{Value: int64(min(leftVal.Sign(), 0))}
+			}
+			return object.IntegerFromBig(new(big.Int).Rsh(leftVal, uint(rightVal.Int64())))
+		}
+		if leftVal.Sign() == 0 {
+			return &object.Integer{Value: 0}
+		}
+		if !rightVal.IsInt64() || rightVal.Int64() > maxIntegerBits-int64(leftVal.BitLen()) {
+			return newError("integer too large: %s << %s", leftVal, rightVal)
+		}
+		return object.IntegerFromBig(new(big.Int).Lsh(leftVal, uint(rightVal.Int64())))
+	case "&":
+		return object.IntegerFromBig(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return object.IntegerFromBig(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return object.IntegerFromBig(new(big.Int).Xor(leftVal, rightVal))
+	case "<":
+		return boolToBoolObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return boolToBoolObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return boolToBoolObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return boolToBoolObject(leftVal.Cmp(rightVal) >= 0)
+	case "!=":
+		return boolToBoolObject(leftVal.Cmp(rightVal) != 0)
+	case "==":
+		return boolToBoolObject(leftVal.Cmp(rightVal) == 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	case "<":
 		return boolToBoolObject(leftVal < rightVal)
 	case ">":
 		return boolToBoolObject(leftVal > rightVal)
+	case "<=":
+		return boolToBoolObject(leftVal <= rightVal)
+	case ">=":
+		return boolToBoolObject(leftVal >= rightVal)
 	case "!=":
 		return boolToBoolObject(leftVal != rightVal)
 	case "==":
@@ -257,27 +789,187 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts a number to a float64; other objects are not numbers, see isNumber
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	}
+	return math.NaN()
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
+	switch {
+	case operator == "+":
+		leftVal := left.(*object.String).Value
+		rightVal := right.(*object.String).Value
+		return &object.String{Value: leftVal + rightVal}
+	case operator == "==", operator == "!=", isOrdering(operator):
+		return evalOrdering(operator, left, right)
+	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
+}
+
+func isOrdering(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+// evalOrdering compares objects that object.Compare orders, such as strings and arrays
+func evalOrdering(operator string, left, right object.Object) object.Object {
+	order, err := object.Compare(left, right)
+	if err != nil {
+		return newError("%s", err)
+	}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "<":
+		return boolToBoolObject(order < 0)
+	case ">":
+		return boolToBoolObject(order > 0)
+	case "<=":
+		return boolToBoolObject(order <= 0)
+	case ">=":
+		return boolToBoolObject(order >= 0)
+	case "==":
+		return boolToBoolObject(order == 0)
+	default:
+		return boolToBoolObject(order != 0)
+	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.evalNode(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.evalNode(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.evalNode(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// evalTryExpression runs the catch block if the try block raised an error, and the finally
+// block whatever happened, even if the try or catch block returned or left a loop. An
+// exceeded limit is not caught, and skips the finally block too.
+func (e *evaluation) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.evalNode(te.Block, env)
+	if e.aborted != nil {
+		return result
+	}
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		// The catch block has bindings of its own, so the parameter hides a variable of
+		// the same name rather than overwriting it
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if te.Parameter != nil {
+			catchEnv.Set(te.Parameter.Value, CaughtValue(err))
+		}
+		result = e.evalNode(te.Catch, catchEnv)
+		if e.aborted != nil {
+			return result
+		}
+	}
+
+	if te.Finally != nil {
+		// unless the finally block itself leaves early, the try expression's result stands
+		finally := e.evalNode(te.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_VALUE_OBJ || ft == object.ERROR_OBJ || ft == object.BREAK_OBJ || ft == object.CONTINUE_OBJ {
+				return finally
+			}
+		}
+	}
+
+	return result
+}
+
+// Loops, like `if`, run their body in the enclosing environment, and have no value
+func (e *evaluation) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := e.evalNode(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, done := e.evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+func (e *evaluation) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	collection := e.evalNode(fs.Collection, env)
+	if isError(collection) {
+		return collection
+	}
+
+	iterator := newIterator(collection)
+	if isError(iterator) {
+		return iterator
+	}
+
+	for {
+		key, value, ok := iterator.(*object.Iterator).Next()
+		if !ok {
+			return nil
+		}
+
+		if fs.Key != nil {
+			env.Set(fs.Key.Value, key)
+		}
+		env.Set(fs.Value.Value, value)
+
+		if result, done := e.evalLoopBody(fs.Body, env); done {
+			return result
+		}
+	}
+}
+
+func newIterator(collection object.Object) object.Object {
+	iterator, ok := object.NewIterator(collection)
+	if !ok {
+		return newError("cannot iterate over %s", collection.Type())
+	}
+	return iterator
+}
+
+// evalLoopBody runs one iteration, reporting whether the loop is done and with what result
+func (e *evaluation) evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	if err := e.checkCancelled(); err != nil {
+		return err, true
+	}
+
+	result := e.evalNode(body, env)
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return nil, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	}
+	return nil, false
+}
+
 func isTruthy(obj object.Object) bool {
 	return obj != NULL && obj != FALSE
 }
@@ -286,31 +978,279 @@ func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR_OBJ
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *evaluation) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if built_in, ok := built_ins[node.Value]; ok {
-		return built_in
+	if built_in, ok := e.builtIns[node.Value]; ok {
+		return e.bindBuiltIn(built_in)
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
+func (e *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Get(target.Value)
+		if !ok && node.Operator != "=" {
+			return newError("identifier not found: " + target.Value)
+		}
+		value := e.evalNode(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if node.Operator != "=" {
+			if err := e.reserve(InfixSize(strings.TrimSuffix(node.Operator, "="), current, value)); err != nil {
+				return err
+			}
+		}
+		value = applyAssignmentOperator(node.Operator, current, value)
+		if isError(value) {
+			return value
+		}
+		if !env.Assign(target.Value, value) {
+			return newError("identifier not found: " + target.Value)
+		}
+		return value
+	case *ast.IndexExpression:
+		left := e.evalNode(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.evalNode(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		value := e.evalNode(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if e.limits.MaxAllocatedBytes > 0 {
+			if err := e.reserve(IndexAssignmentSize(node.Operator, left, index, value)); err != nil {
+				return err
+			}
+		}
+		return evalIndexAssignment(node.Operator, left, index, value)
+	}
+	return newError("cannot assign to %s", node.Target.String())
+}
+
+// applyAssignmentOperator combines the current value with the assigned one, so that
+// `x += 1` assigns `x + 1`; a plain `=` assigns the value as it is
+func applyAssignmentOperator(operator string, current, value object.Object) object.Object {
+	if operator == "=" {
+		return value
+	}
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, value)
+}
+
+func evalIndexAssignment(operator string, left, index, value object.Object) object.Object {
+	if operator != "=" {
+		current := evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+		value = applyAssignmentOperator(operator, current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER_OBJ {
+			return newError("index assignment not supported for %s", left.Type())
+		}
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			// a BigInt is out of range of any array
+			return newError("index out of range: %s", index.Inspect())
+		}
+		i := idx.Value
+		if i < 0 {
+			i += int64(len(left.Elements))
+		}
+		if i < 0 || i >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		left.Elements[i] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported for %s", left.Type())
+	}
+	return value
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
-	if left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ {
+	if left.Type() == object.ARRAY_OBJ {
 		return evalArrayIndexExpression(left, index)
 	}
 	if left.Type() == object.HASH_OBJ {
 		return evalHashIndexExpression(left, index)
 	}
+	if left.Type() == object.STRING_OBJ {
+		return evalStringIndexExpression(left, index)
+	}
 	return newError("index operator not supported for %s", left.Type())
 }
 
+// evalStringIndexExpression returns the character at an index of a string, counting
+// characters rather than bytes, as a string of its own
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	if index.Type() != object.INTEGER_OBJ {
+		return newError("string index must be an integer, got %s", index.Type())
+	}
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+	runes := []rune(str.(*object.String).Value)
+	idx := integer.Value
+	if idx < 0 {
+		idx = int64(len(runes)) + idx
+	}
+	if idx < 0 || idx >= int64(len(runes)) {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
+}
+
+// evalSliceExpression slices an array, or a string by character, as Python does: negative
+// bounds count from the end, bounds out of range are clamped, and a negative step walks
+// backwards, from the end by default. A bound left out is null.
+func evalSliceExpression(left, start, end, step object.Object) object.Object {
+	from, to, stepBy, err := sliceRange(left, start, end, step)
+	if err != nil {
+		return err
+	}
+	count := sliceCount(from, to, stepBy)
+
+	if array, ok := left.(*object.Array); ok {
+		elements := make([]object.Object, 0, count)
+		for i := from; (stepBy > 0 && i < to) || (stepBy < 0 && i > to); i += stepBy {
+			elements = append(elements, array.Elements[i])
+		}
+		return &object.Array{Elements: elements}
+	}
+	runes := []rune(left.(*object.String).Value)
+	sliced := make([]rune, 0, count)
+	for i := from; (stepBy > 0 && i < to) || (stepBy < 0 && i > to); i += stepBy {
+		sliced = append(sliced, runes[i])
+	}
+	return &object.String{Value: string(sliced)}
+}
+
+// sliceRange resolves left[start:end:step] to the index the slice starts from, the one it
+// stops before, and the step between them
+func sliceRange(left, start, end, step object.Object) (from, to, stepBy int64, err *object.Error) {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	default:
+		return 0, 0, 0, newError("slice operator not supported for %s", left.Type())
+	}
+
+	stepBy = 1
+	if step != NULL {
+		if stepBy, err = sliceBound(step); err != nil {
+			return 0, 0, 0, err
+		}
+		if stepBy == 0 {
+			return 0, 0, 0, newError("slice step cannot be zero")
+		}
+		// A step longer than the sequence takes at most one element either way, and
+		// keeps the index from overflowing
+		stepBy = max(min(stepBy, int64(length)+1), -int64(length)-1)
+	}
+
+	// The first and last indexes the slice may reach, stepping forward or backward
+	lower, upper := int64(0), int64(length)
+	if stepBy < 0 {
+		lower, upper = -1, int64(length)-1
+	}
+	from, fromErr := clampSliceBound(start, length, lower, upper, stepBy < 0)
+	to, toErr := clampSliceBound(end, length, lower, upper, stepBy > 0)
+	if fromErr != nil {
+		return 0, 0, 0, fromErr
+	}
+	if toErr != nil {
+		return 0, 0, 0, toErr
+	}
+	return from, to, stepBy, nil
+}
+
+// sliceCount is the number of elements a slice from, to, stepBy takes
+func sliceCount(from, to, stepBy int64) int64 {
+	switch {
+	case stepBy > 0 && to > from:
+		return (to - from + stepBy - 1) / stepBy
+	case stepBy < 0 && from > to:
+		return (from - to - stepBy - 1) / -stepBy
+	default:
+		return 0
+	}
+}
+
+// clampSliceBound resolves a bound of a slice of a sequence of length elements to an index
+// from lower to upper, defaulting to upper if it is left out and toUpper is set, or else to
+// lower
+func clampSliceBound(bound object.Object, length int, lower, upper int64, toUpper bool) (int64, *object.Error) {
+	if bound == NULL {
+		if toUpper {
+			return upper, nil
+		}
+		return lower, nil
+	}
+	idx, err := sliceBound(bound)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 {
+		idx += int64(length)
+	}
+	return max(lower, min(idx, upper)), nil
+}
+
+// sliceBound returns the integer value of a bound or step of a slice, with a BigInt, which
+// is out of range of any sequence, as the nearest int64
+func sliceBound(bound object.Object) (int64, *object.Error) {
+	if integer, ok := bound.(*object.Integer); ok {
+		return integer.Value, nil
+	}
+	value, ok := object.BigValue(bound)
+	if !ok {
+		return 0, newError("slice indexes must be integers, got %s", bound.Type())
+	}
+	if value.Sign() < 0 {
+		return math.MinInt64, nil
+	}
+	return math.MaxInt64, nil
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
+	arrayObject, ok := array.(*object.Array)
+	if !ok {
+		return newError("index operator not supported for %s", array.Type())
+	}
+	if index.Type() != object.INTEGER_OBJ {
+		return newError("array index must be an integer, got %s", index.Type())
+	}
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// a BigInt is out of range of any array
+		return NULL
+	}
+	idx := integer.Value
 	max := int64(len(arrayObject.Elements) - 1)
 	if idx < 0 {
 		idx = int64(len(arrayObject.Elements)) + idx
@@ -322,14 +1262,14 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
-func evalHashLiteral(
+func (e *evaluation) evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := e.evalNode(keyNode, env)
 		if isError(key) {
 			return key
 		}
@@ -340,7 +1280,7 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.evalNode(valueNode, env)
 
 		if isError(value) {
 			return value
@@ -353,7 +1293,10 @@ func evalHashLiteral(
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
+	hashObject, ok := hash.(*object.Hash)
+	if !ok {
+		return newError("index operator not supported for %s", hash.Type())
+	}
 
 	key, ok := index.(object.Hashable)
 
@@ -1,10 +1,15 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -248,6 +253,33 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let x = 1;\nlet y = x * foo;", 2, 13},
+		{"let f = fn(a) {\n  a - \"b\"\n};\nf(1);", 2, 5},
+		{"len(1, 2);", 1, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got %T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong error position. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Pos.Line, errObj.Pos.Column)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -461,6 +493,57 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{"[1, 2, 3, 4, 5][1:3];", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2];", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][2:];", "[3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][:];", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:];", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-2];", "[1, 2, 3]"},
+		{"[1, 2, 3, 4, 5][::2];", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][1::2];", "[2, 4]"},
+		{"[1, 2, 3, 4, 5][::-1];", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:1:-1];", "[4, 3]"},
+		{"[1, 2, 3, 4, 5][-1:-4:-2];", "[5, 3]"},
+		{"[1, 2, 3, 4, 5][3:1];", "[]"},
+		{"[1, 2, 3, 4, 5][10:];", "[]"},
+		{"[1, 2, 3, 4, 5][-10:2];", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][1:100000000000000000000];", "[2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][::100000000000000000000];", "[1]"},
+		{"[1, 2, 3, 4, 5][::-100000000000000000000];", "[5]"},
+		{"[][:];", "[]"},
+		{"let xs = [1, 2]; let ys = xs[:]; ys[0] = 5; xs;", "[1, 2]"},
+		{"let i = 1; [1, 2, 3][i:i + 1];", "[2]"},
+
+		{`"hello"[1:3];`, "el"},
+		{`"héllo, 世界"[:5];`, "héllo"},
+		{`"héllo, 世界"[-2:];`, "世界"},
+		{`"héllo, 世界"[::-1];`, "界世 ,olléh"},
+		{`"abc"[5:];`, ""},
+		{`"héllo"[1];`, "é"},
+		{`"世界"[-1];`, "界"},
+		{`"abc"[3];`, "null"},
+
+		{"[1, 2, 3][::0];", "ERROR: 1:10: slice step cannot be zero"},
+		{`[1, 2, 3]["a":];`, "ERROR: 1:10: slice indexes must be integers, got STRING"},
+		{"[1, 2, 3][:1.5];", "ERROR: 1:10: slice indexes must be integers, got FLOAT"},
+		{"{}[1:2];", "ERROR: 1:3: slice operator not supported for HASH"},
+		{"5[1:2];", "ERROR: 1:2: slice operator not supported for INTEGER"},
+		{`"abc"["a"];`, "ERROR: 1:6: string index must be an integer, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashLiteral(t *testing.T) {
 	input := `let two = "two"; {
 		"one": 10 - 9,
@@ -545,3 +628,947 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1; }; i;", 10},
+		{"let i = 0; while (false) { let i = i + 1; }; i;", 0},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i;", 5},
+		{"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + i; }; n;", 6},
+		{"let f = fn() { while (true) { return 7; } }; f();", 7},
+		{"while (true) { 1 + true; }", "type mismatch: INTEGER + BOOLEAN"},
+		{"while (x) { 1; }", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let n = 0; for (x in [1, 2, 3]) { let n = n + x; }; n;", 6},
+		{"let n = 0; for (i, x in [10, 20, 30]) { let n = n + i * x; }; n;", 80},
+		{"let n = 0; for (x in []) { let n = n + 1; }; n;", 0},
+		{`let n = 0; for (c in "héllo") { let n = n + 1; }; n;`, 5},
+		{`let s = ""; for (i, c in "abc") { let s = c + s; }; s;`, "cba"},
+		{`let s = ""; for (k, v in {"b": "2", "a": "1", "c": "3"}) { let s = s + k + v; }; s;`, "a1b2c3"},
+		{"let n = 0; for (v in {3: 30, 1: 10, 2: 20}) { let n = n * 100 + v; }; n;", 102030},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } let n = n + x; }; n;", 3},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue; } let n = n + x; }; n;", 7},
+		{"let n = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } let n = n + x * y; } }; n;", 30},
+		{"let find = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; find([1, 5, 9]);", 5},
+		{"for (x in 5) { x; }", "cannot iterate over INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLongLoopsDoNotRecurse(t *testing.T) {
+	input := `
+	let i = 0;
+	let total = 0;
+	while (i < 100000) { let total = total + i; let i = i + 1; };
+	for (x in [1, 2, 3]) { let total = total + x; };
+	total;
+	`
+	testIntegerObject(t, testEval(input), 4999950006)
+}
+
+// testExpectedObject checks evaluated against an int, float64 or bool, or a string,
+// which is either the expected string or the message of the expected error
+func testExpectedObject(t *testing.T, input string, evaluated object.Object, expected interface{}) {
+	switch expected := expected.(type) {
+	case int:
+		testIntegerObject(t, evaluated, int64(expected))
+	case float64:
+		testFloatObject(t, evaluated, expected)
+	case bool:
+		testBooleanObject(t, evaluated, expected)
+	case string:
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", input, expected, errObj.Message)
+			}
+			return
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%q: expected %q, got=%T (%+v)", input, expected, evaluated, evaluated)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x;", 2},
+		{"let x = 1; x = 2;", 2},
+		{"let a = 1; let b = 1; a = b = 3; a + b;", 6},
+		{"let x = 10; x += 5; x;", 15},
+		{"let x = 10; x -= 5; x;", 5},
+		{"let x = 10; x *= 5; x;", 50},
+		{"let x = 10; x /= 5; x;", 2},
+		{"let x = 17; x %= 5; x;", 2},
+		{"let x = -7; x %= 3; x;", -1},
+		{"let xs = [10, 11]; xs[1] %= 4; xs[1];", 3},
+		{`let s = "a"; s += "b"; s;`, "ab"},
+		{"let x = 1; let f = fn() { x = 5; }; f(); x;", 5},
+		{"let x = 1; let f = fn() { let x = 2; x = 5; }; f(); x;", 1},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c();", 3},
+		{"let i = 0; while (i < 5) { i += 1; }; i;", 5},
+		{"let xs = [1, 2, 3]; xs[0] = 10; xs[-1] += 20; xs[0] + xs[2];", 33},
+		{`let h = {"a": 1}; h["a"] += 1; h["b"] = 5; h["a"] * h["b"];`, 10},
+		{"let xs = [1]; let ys = xs; ys[0] = 2; xs[0];", 2},
+		{"x = 1;", "identifier not found: x"},
+		{"x += 1;", "identifier not found: x"},
+		{"let x = 1; x += true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x %= 0;", "division by zero"},
+		{"let xs = [1]; xs[1] = 2;", "index out of range: 1"},
+		{`let xs = [1]; xs["a"] = 2;`, "index assignment not supported for ARRAY"},
+		{`let s = "a"; s[0] = "b";`, "index assignment not supported for STRING"},
+		{`let h = {}; h[fn(x) { x }] = 1;`, "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. Got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. Got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.5;", 3.5},
+		{"-2.5;", -2.5},
+		{".5 + .25;", 0.75},
+		{"1.5 * 2;", 3.0},
+		{"2 * 1.5;", 3.0},
+		{"7 / 2;", 3},
+		{"7 / 2.0;", 3.5},
+		{"1 - 0.5;", 0.5},
+		{"1e3 + 1;", 1001.0},
+		{"1 / 0.0 > 1e308;", true},
+		{"1 == 1.0;", true},
+		{"1.5 != 1;", true},
+		{"0.5 < 1;", true},
+		{"2 > 2.5;", false},
+		{"let x = 1; x += 0.5; x;", 1.5},
+		{"{1: \"one\"}[1.0];", "one"},
+		{"{2.5: \"x\"}[2.5];", "x"},
+		{"1.5 + true;", "type mismatch: FLOAT + BOOLEAN"},
+		{"-true;", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNumberConversionBuiltIns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3);", 3},
+		{"int(3.99);", 3},
+		{"int(-3.99);", -3},
+		{`int(" 42 ");`, 42},
+		{`int("4.2");`, `cannot convert "4.2" to an integer`},
+		{"int(1e20) == 100000000000000000000;", true},
+		{"int(true);", "argument to `int` not supported, got BOOLEAN"},
+		{"int(1, 2);", "wrong number of arguments to `int`: got 2"},
+		{"float(3);", 3.0},
+		{"float(2.5);", 2.5},
+		{`float("2.5");`, 2.5},
+		{`float("abc");`, `cannot convert "abc" to a float`},
+		{"round(2.5);", 3},
+		{"round(-2.5);", -3},
+		{"round(2.4);", 2},
+		{"round(7);", 7},
+		{"floor(2.7);", 2},
+		{"floor(-2.1);", -3},
+		{"ceil(2.1);", 3},
+		{"ceil(-2.7);", -2},
+		{"floor(1.0 / 0.0);", "cannot convert +Inf to an integer"},
+		{`ceil("1");`, "argument to `ceil` not supported, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{"100000000000000000000;", "100000000000000000000"},
+		{"9223372036854775807 + 1;", "9223372036854775808"},
+		{"-9223372036854775807 - 2;", "-9223372036854775809"},
+		{"9223372036854775807 * 2;", "18446744073709551614"},
+		{"-9223372036854775807 - 1;", "-9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1;", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1);", "9223372036854775808"},
+		{"-100000000000000000000;", "-100000000000000000000"},
+		{"100000000000000000000 / 3;", "33333333333333333333"},
+		{"100000000000000000000 - 99999999999999999999;", "1"},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25);", "15511210043330985984000000"},
+		{"let total = 9223372036854775000; total += 1000; total -= 1000; total;", "9223372036854775000"},
+		{"100000000000000000000 > 9223372036854775807;", "true"},
+		{"100000000000000000000 < -100000000000000000000;", "false"},
+		{"100000000000000000000 == 100000000000000000000;", "true"},
+		{"100000000000000000000 != 100000000000000000001;", "true"},
+		{"100000000000000000000 + 0.5;", "1e+20"},
+		{"float(100000000000000000000);", "1e+20"},
+		{"round(100000000000000000000);", "100000000000000000000"},
+		{`int("-100000000000000000000");`, "-100000000000000000000"},
+		{`{100000000000000000000: "big"}[100000000000000000000];`, "big"},
+		{`{100000000000000000000: "big"}[1e20];`, "big"},
+		{"[1][100000000000000000000];", "null"},
+		{"sort([100000000000000000000, 1, -100000000000000000000, 9223372036854775807]);",
+			"[-100000000000000000000, 1, 9223372036854775807, 100000000000000000000]"},
+		{"100000000000000000000 + true;", "ERROR: 1:23: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{"7 % 3;", "1"},
+		{"-7 % 3;", "-1"},
+		{"7 % -3;", "1"},
+		{"7.5 % 2;", "1.5"},
+		{"100000000000000000001 % 10;", "1"},
+		{"(-9223372036854775807 - 1) % -1;", "0"},
+		{"5 % 0;", "ERROR: 1:3: division by zero"},
+		{"let x = 10; x %= 4; x;", "2"},
+
+		{"2 ** 10;", "1024"},
+		{"2 ** 3 ** 2;", "512"},
+		{"-2 ** 2;", "-4"},
+		{"(-2) ** 3;", "-8"},
+		{"2 ** 0;", "1"},
+		{"2 ** -2;", "0.25"},
+		{"2 ** 100;", "1267650600228229401496703205376"},
+		{"4 ** 0.5;", "2.0"},
+		{"1 ** 100000000000000000000;", "1"},
+		{"2 ** 100000000000000000000;", "ERROR: 1:3: integer too large: 2 ** 100000000000000000000"},
+
+		{"1 <= 2;", "true"},
+		{"2 <= 2;", "true"},
+		{"3 <= 2;", "false"},
+		{"1 >= 2;", "false"},
+		{"2.5 >= 2;", "true"},
+		{"100000000000000000000 >= 9223372036854775807;", "true"},
+		{`"a" <= "b";`, "true"},
+
+		{"6 & 3;", "2"},
+		{"6 | 3;", "7"},
+		{"6 ^ 3;", "5"},
+		{"~5;", "-6"},
+		{"~-1;", "0"},
+		{"~100000000000000000000;", "-100000000000000000001"},
+		{"1 << 4;", "16"},
+		{"1 << 64;", "18446744073709551616"},
+		{"-16 >> 2;", "-4"},
+		{"1 >> 100;", "0"},
+		{"-1 >> 100;", "-1"},
+		{"(1 << 64) >> 60;", "16"},
+		{"(1 << 64) | 1;", "18446744073709551617"},
+		{"1 << -1;", "ERROR: 1:3: negative shift count: -1"},
+		{"1 >> -1;", "ERROR: 1:3: negative shift count: -1"},
+		{"1 << 100000000000000000000;", "ERROR: 1:3: integer too large: 1 << 100000000000000000000"},
+		{"0 << 100000000000000000000;", "0"},
+		{"1.5 & 1;", "ERROR: 1:5: unknown operator: FLOAT & INTEGER"},
+		{"~1.5;", "ERROR: 1:1: unknown operator: ~FLOAT"},
+		{"x & 1 == 0;", "ERROR: 1:1: identifier not found: x"},
+		{"let x = 6; x & 1 == 0;", "true"},
+
+		{"true && false;", "false"},
+		{"1 && 2;", "2"},
+		{"false && x;", "false"},
+		{"true || x;", "true"},
+		{`false || "default";`, "default"},
+		{"if (false) { 1 } || 2;", "2"},
+		{"false || x;", "ERROR: 1:10: identifier not found: x"},
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n;", "0"},
+		{"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n;", "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{`"a" == "a";`, "true"},
+		{`"a" != "a";`, "false"},
+		{`"a" < "b";`, "true"},
+		{`"b" > "abc";`, "true"},
+		{`"ab" >= "ab";`, "true"},
+		{`"" < "a";`, "true"},
+		{`"Z" < "a";`, "true"},
+		{`"é" > "z";`, "true"},
+		{`"a" - "b";`, "ERROR: 1:5: unknown operator: STRING - STRING"},
+
+		{"[1, 2] == [1, 2];", "true"},
+		{"[1, 2] != [1, 2];", "false"},
+		{"[1, 2] == [2, 1];", "false"},
+		{"[1, 2] == [1, 2, 3];", "false"},
+		{"[1, [2, 3]] == [1, [2, 3]];", "true"},
+		{"[1] == [1.0];", "true"},
+		{`[1] == ["1"];`, "false"},
+		{"[] == [];", "true"},
+		{"let xs = [1]; xs == xs;", "true"},
+		{"[1, 2] < [1, 3];", "true"},
+		{"[1, 2] < [1, 2, 0];", "true"},
+		{"[2] > [1, 9];", "true"},
+		{"[1, 2] <= [1, 2];", "true"},
+		{`[["a", 1]] < [["a", 2]];`, "true"},
+		{`[1] < ["a"];`, "ERROR: 1:5: cannot order INTEGER and STRING"},
+		{"[{}] < [{}];", "ERROR: 1:6: cannot order HASH values"},
+		{"[1] < 1;", "ERROR: 1:5: type mismatch: ARRAY < INTEGER"},
+
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1};`, "true"},
+		{`{"a": 1} == {"a": 2};`, "false"},
+		{`{"a": 1} == {"b": 1};`, "false"},
+		{`{"a": 1} == {"a": 1, "b": 2};`, "false"},
+		{"{1: true} == {1.0: true};", "true"},
+		{"{} < {};", "ERROR: 1:4: unknown operator: HASH < HASH"},
+
+		{`1 == "1";`, "false"},
+		{"1 != true;", "true"},
+		{"true == true;", "true"},
+		{"if (false) { 1 } == if (false) { 2 };", "true"},
+		{"let f = fn() { 1 }; f == f;", "true"},
+		{"fn() { 1 } == fn() { 1 };", "false"},
+		{"len == len;", "true"},
+		{"let xs = [1]; xs[0] = xs; xs == xs;", "true"},
+		{"let xs = [1]; xs[0] = xs; let ys = [1]; ys[0] = ys; xs == ys;", "true"},
+
+		{`sort(["b", "c", "a"]);`, "[a, b, c]"},
+		{"sort([2.5, 1, -3, 100000000000000000000]);", "[-3, 1, 2.5, 100000000000000000000]"},
+		{"sort([[2], [1, 5], [1]]);", "[[1], [1, 5], [2]]"},
+		{"sort([{}, {}]);", "ERROR: 1:5: cannot `sort`: cannot order HASH values"},
+		{`let xs = [2, "a", 1]; try { sort(xs) } catch { xs };`, "[2, a, 1]"},
+		{"let xs = [3, 1, 2]; sort(xs); xs;", "[1, 2, 3]"},
+		{`{"b": 2, "a": 1, "c": 3}.keys();`, "[a, b, c]"},
+		{`{2.5: "x", 10.5: "y"}.values();`, "[x, y]"},
+		{"[[1, 2], [3]].contains([3]);", "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringBuiltIns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{`split("a,b,,c", ",");`, "[a, b, , c]"},
+		{`split("héllo", "");`, "[h, é, l, l, o]"},
+		{`split("", ",");`, "[]"},
+		{`join(["a", "é", "c"], ", ");`, "a, é, c"},
+		{`["x", "y"].join();`, "xy"},
+		{`[].join("-");`, ""},
+		{`trim("  héllo \n");`, "héllo"},
+		{`trim("¡¡hola!!", "¡!");`, "hola"},
+		{`upper("héllo ß");`, "HÉLLO ß"},
+		{`"ÀÉÎ".lower();`, "àéî"},
+		{`replace("aaa", "a", "b");`, "bbb"},
+		{`"aaa".replace("a", "bé", 2);`, "bébéa"},
+		{`"aaa".replace("a", "b", 0);`, "aaa"},
+		{`contains("héllo", "éll");`, "true"},
+		{`"héllo".contains("z");`, "false"},
+		{`contains([1, [2]], [2]);`, "true"},
+		{`startsWith("héllo", "hé");`, "true"},
+		{`"héllo".endsWith("lo");`, "true"},
+		{`"héllo".endsWith("hé");`, "false"},
+		{`indexOf("héllo", "l");`, "2"},
+		{`"日本語".indexOf("語");`, "2"},
+		{`"héllo".indexOf("z");`, "-1"},
+		{`let s = "héllo"; s[s.indexOf("l")];`, "l"},
+		{`repeat("ab", 3);`, "ababab"},
+		{`"é".repeat(0);`, ""},
+		{`chars("日本");`, "[日, 本]"},
+		{`"".chars();`, "[]"},
+		{`runeLen("日本語");`, "3"},
+		{`len("日本語");`, "9"},
+		{`ord("é");`, "233"},
+		{`ord("😀");`, "128512"},
+		{"chr(233);", "é"},
+		{"chr(128512);", "😀"},
+		{`chr(ord("a") + 1);`, "b"},
+
+		{`format("%s is %d", "Ann", 30);`, "Ann is 30"},
+		{`format("%.2f%%", 99.5);`, "99.50%"},
+		{`format("%f", 2);`, "2.000000"},
+		{`format("|%5s|%-4d|%04d|", "日本", 7, 42);`, "|   日本|7   |0042|"},
+		{`format("%x %X %b %o", 255, 255, 5, 8);`, "ff FF 101 10"},
+		{`format("%x", "hi");`, "6869"},
+		{`format("%q", "hé");`, `"hé"`},
+		{`format("%v and %s", [1, "a"], {"k": true});`, "[1, a] and {k: true}"},
+		{`format("%c%c", 9731, 233);`, "☃é"},
+		{`format("%t", false);`, "false"},
+		{`format("%d", 100000000000000000000);`, "100000000000000000000"},
+		{`"%s!".format("hi");`, "hi!"},
+		{`format("no directives");`, "no directives"},
+
+		{`split("a");`, "ERROR: 1:6: wrong number of arguments to `split`: got 1"},
+		{`split("a", 1);`, "ERROR: 1:6: argument 2 to `split` must be a string, but got INTEGER"},
+		{"upper(1);", "ERROR: 1:6: argument to `upper` must be a string, but got INTEGER"},
+		{"[1].join();", "ERROR: 1:4: cannot `join` INTEGER element 0, only strings"},
+		{`"a".join();`, "ERROR: 1:4: argument to `join` must be an array, but got STRING"},
+		{`"a".replace("a", "b", -1);`, "ERROR: 1:4: cannot `replace` a negative number of times: -1"},
+		{`"a".repeat(-1);`, "ERROR: 1:4: cannot `repeat` a negative number of times: -1"},
+		{`"ab".repeat(100000000000000000000);`, "ERROR: 1:5: string too long: `repeat` would make more than 1073741824 bytes"},
+		{`ord("ab");`, `ERROR: 1:4: argument to ` + "`ord`" + ` must be a single character, but got "ab"`},
+		{`ord("");`, `ERROR: 1:4: argument to ` + "`ord`" + ` must be a single character, but got ""`},
+		{"chr(-1);", "ERROR: 1:4: -1 is not a valid Unicode code point"},
+		{"chr(55296);", "ERROR: 1:4: 55296 is not a valid Unicode code point"},
+		{"chr(1114112);", "ERROR: 1:4: 1114112 is not a valid Unicode code point"},
+		{`format("%d", "a");`, "ERROR: 1:7: argument 2 to `format` must be an integer for %d, but got STRING"},
+		{`format("%.1f", "a");`, "ERROR: 1:7: argument 2 to `format` must be a number for %.1f, but got STRING"},
+		{`format("%d");`, "ERROR: 1:7: not enough arguments to `format`: no value for %d"},
+		{`format("x", 1);`, "ERROR: 1:7: too many arguments to `format`: 1 left over"},
+		{`format("%z", 1);`, "ERROR: 1:7: unknown `format` verb 'z' in %z"},
+		{`format("%5");`, "ERROR: 1:7: `format` directive \"%5\" has no verb"},
+		{`format("%5%");`, "ERROR: 1:7: `format` directive \"%5%\" takes no flags, width or precision"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the Inspect() output
+	}{
+		{"[1, 2, 3].first();", "1"},
+		{"[1, 2, 3].last();", "3"},
+		{"[1, 2, 3].rest();", "[2, 3]"},
+		{"[].first();", "null"},
+		{"[].rest();", "null"},
+		{"[1, 2, 3].contains(2);", "true"},
+		{`[1, 2, 3].contains("2");`, "false"},
+		{"[1, 2, 3].map(fn(x) { x * 2 });", "[2, 4, 6]"},
+		{"[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 });", "[2, 4]"},
+		{"[1, 2, 3, 4].reduce(fn(sum, x) { sum + x });", "10"},
+		{"[1, 2, 3].reduce(fn(sum, x) { sum + x }, 10);", "16"},
+		{"[].reduce(fn(sum, x) { sum + x }, 0);", "0"},
+		{"[].reduce(fn(sum, x) { sum + x });", "ERROR: 1:3: cannot `reduce` an empty array without an initial value"},
+		{"[1].map(5);", "ERROR: 1:4: argument to `map` must be a function, but got INTEGER"},
+		{"[1].map(fn(x) { x + true });", "ERROR: 1:19: type mismatch: INTEGER + BOOLEAN"},
+		{"[1].first(2);", "ERROR: 1:4: wrong number of arguments to `first`: got 1"},
+		{"[1, 2, 3].map(fn(x) { x * 2 }).filter(fn(x) { x > 2 }).len();", "2"},
+
+		{`"héllo".reverse();`, "olléh"},
+		{`"one\ntwo\r\n".lines();`, "[one, two]"},
+		{`"".lines();`, "[]"},
+		{`"  a  b\tc ".words();`, "[a, b, c]"},
+
+		{`{"a": 1}.keys();`, "[a]"},
+		{`{"a": 1}.values();`, "[1]"},
+		{`{"a": 1}.has("a");`, "true"},
+		{`{"a": 1}.has("b");`, "false"},
+		{`{"a": 1}.get("a", 0);`, "1"},
+		{`{"a": 1}.get("b", 0);`, "0"},
+		{`{"a": 1}.get("b");`, "null"},
+		{`{"a": 1}.has([]);`, "ERROR: 1:9: unusable as hash key: ARRAY"},
+
+		{"(-5).abs();", "5"},
+		{"(-9223372036854775807 - 1).abs();", "9223372036854775808"},
+		{"(-5).sign();", "-1"},
+		{"0.sign();", "0"},
+		{"255.toString();", "255"},
+		{"255.toString(2);", "11111111"},
+		{"(-255).toString(16);", "-ff"},
+		{"255.toString(37);", "ERROR: 1:4: base must be from 2 to 36, got 37"},
+
+		// other methods are the built-in of the same name
+		{"[1, 2].push(3);", "[1, 2, 3]"},
+		{`"four".len();`, "4"},
+		{`["a", "bb"].transform(len);`, "[1, 2]"},
+		{"3.7.round();", "4"},
+		{"[3, 1, 2].reverse();", "[2, 1, 3]"},
+		{"[1].nope();", "ERROR: 1:4: undefined method nope for ARRAY"},
+		{"true.len();", "ERROR: 1:5: argument to `len` not supported, got BOOLEAN"},
+
+		// a name without arguments indexes a hash
+		{`let h = {"name": "Monkey"}; h.name;`, "Monkey"},
+		{`let h = {"name": "Monkey"}; h.age;`, "null"},
+		{`let h = {"n": 1}; h.n += 1; h.m = 5; [h.n, h.m];`, "[2, 5]"},
+		{`let h = {"inner": {"x": 1}}; h.inner.x;`, "1"},
+		{"[1].name;", "ERROR: 1:4: array index must be an integer, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMethodsUseTheInterpretersBuiltIns(t *testing.T) {
+	in := NewEmptyInterpreter()
+	in.Register("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	result, err := in.EvalString("[21.double(), [1].map(fn(x) { x })];")
+	if err != nil || result.Inspect() != "[42, [1]]" {
+		t.Errorf("expected [42, [1]], got=%v, %v", result, err)
+	}
+	if _, err := in.EvalString(`"x".len();`); err == nil || err.Error() != "1:4: undefined method len for STRING" {
+		t.Errorf("expected len to be undefined, got=%v", err)
+	}
+}
+
+func TestIntegersDemoteOnceTheyFit(t *testing.T) {
+	tests := []string{
+		"(9223372036854775807 + 1) - 1;",
+		"100000000000000000000 / 100000000000000000000;",
+		"-9223372036854775808;",
+		"9223372036854775808 - 1;",
+	}
+
+	for _, input := range tests {
+		if _, ok := testEval(input).(*object.Integer); !ok {
+			t.Errorf("%q: expected an Integer, got=%T", input, testEval(input))
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 };", 1},
+		{"try { 1 + true } catch (e) { 2 };", 2},
+		{`try { throw "bad"; } catch (e) { e["message"] };`, "bad"},
+		{`try { throw "bad"; } catch (e) { e["kind"] };`, "Error"},
+		{`try { len(1) } catch (e) { e["message"] };`, "argument to `len` not supported, got INTEGER"},
+		{`try { [1][0] + "a" } catch (e) { e["kind"] };`, "RuntimeError"},
+		{`try { throw {"message": "m", "kind": "ValueError"}; } catch (e) { e["kind"] + ": " + e["message"] };`, "ValueError: m"},
+		{"try { throw 5; } catch { 7 };", 7},
+		{`try { throw [1, 2]; } catch (e) { e["message"] };`, "[1, 2]"},
+		{"let x = 0; try { x = 1; } finally { x += 10; }; x;", 11},
+		{"let x = 0; try { 1 + true; } catch (e) { x = 1; } finally { x += 10; }; x;", 11},
+		{"let x = 0; try { try { throw 1; } finally { x = 5; } } catch { x += 1 }; x;", 6},
+		{"try { 1 } finally { 2 };", 1},
+		{`try { throw "a"; } catch (e) { throw e["message"] + "b"; };`, "ab"},
+		{`throw "uncaught";`, "uncaught"},
+		{"let f = fn() { try { return 1; } finally { 2; } }; f();", 1},
+		{"let f = fn() { try { 1; } finally { return 2; } }; f();", 2},
+		{"let f = fn() { try { throw 1; } catch { return 2; } finally { 3; } }; f();", 2},
+		{"let n = 0; for (i in [1, 2, 3]) { try { if (i == 2) { continue; } n += i; } finally { n += 100; } }; n;", 304},
+		{"let n = 0; while (true) { try { n += 1; if (n > 3) { break; } } finally { n += 10; } }; n;", 22},
+		{"let f = fn(x) { if (x == 0) { throw \"zero\"; } f(x - 1) }; try { f(5) } catch (e) { e[\"message\"] };", "zero"},
+		{`try { transform([1, 2], fn(x) { x + true }) } catch (e) { e["message"] };`, "type mismatch: INTEGER + BOOLEAN"},
+		{`if (1 + "a") { "yes" } else { "no" };`, "type mismatch: INTEGER + STRING"},
+		{`try { if (1 + "a") { "yes" } else { "no" } } catch (e) { e["message"] };`, "type mismatch: INTEGER + STRING"},
+		{`let e = 5; try { throw "x" } catch (e) { 1 }; e;`, 5},
+		{`let f = fn() { let e = "5"; try { throw "x" } catch (e) { e["message"] } + e }; f();`, "x5"},
+		{`let x = 1; try { throw "x" } catch { let x = 2; x = 3; }; x;`, 1},
+		{`let x = 1; try { throw "x" } catch { x = 2; }; x;`, 2},
+		{`try { throw "x" } catch (e) { 1 }; e;`, "identifier not found: e"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCaughtErrorPosition(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"try {\n  1 + true;\n} catch (e) { [e[\"line\"], e[\"column\"]] };", 2, 5},
+		{"try {\n  throw \"x\";\n} catch (e) { [e[\"line\"], e[\"column\"]] };", 2, 3},
+		// a rethrown error keeps the position it was first raised at
+		{"try { try { 1 + true } catch (e) {\n throw e; } } catch (e) { [e[\"line\"], e[\"column\"]] };", 1, 15},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("%q: object is not Array, got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		testIntegerObject(t, array.Elements[0], int64(tt.expectedLine))
+		testIntegerObject(t, array.Elements[1], int64(tt.expectedColumn))
+	}
+}
+
+func TestOperationsThatUsedToPanic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 / 0;", "division by zero"},
+		{"100000000000000000000 / 0;", "division by zero"},
+		{"pop([]);", "cannot `pop` from an empty array"},
+		{"let add = fn(a, b) { a + b }; add(1);", "wrong number of arguments: want=2, got=1"},
+		{`[1, 2]["a"];`, "array index must be an integer, got STRING"},
+		{"[1, 2][true];", "array index must be an integer, got BOOLEAN"},
+		{"insert([1], 5, 2);", "index out of range: 5"},
+		{"insert([1], -1, 2);", "index out of range: -1"},
+		{`try { 1 / 0 } catch (e) { e["message"] };`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPanicsAreReturnedAsErrors(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("explode", &object.BuiltIn{Fn: func(args ...object.Object) object.Object {
+		panic("boom")
+	}})
+
+	program := parser.New(lexer.New("let x = 1;\nexplode();")).ParseProgram()
+	evaluated := Eval(program, env)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error, got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "internal error: boom" {
+		t.Errorf("wrong error message, got=%q", errObj.Message)
+	}
+	if errObj.Kind != object.INTERNAL_ERROR_KIND {
+		t.Errorf("wrong error kind, got=%q", errObj.Kind)
+	}
+}
+
+func TestErrorsRecordTheirStack(t *testing.T) {
+	input := "let inner = fn() { 1 + true };\nlet outer = fn() { inner() };\nouter();"
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error, got=%+v", testEval(input))
+	}
+
+	expected := []struct {
+		function string
+		callPos  string
+	}{
+		{"inner", "2:25"},
+		{"outer", "3:6"},
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong number of frames, got=%+v", errObj.Stack)
+	}
+	for i, frame := range expected {
+		actual := errObj.Stack[i]
+		if actual.Function != frame.function || actual.CallPos.String() != frame.callPos {
+			t.Errorf("frame %d: expected=%+v, got=%+v", i, frame, actual)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          Limits
+		expectedKind    string
+		expectedMessage string
+	}{
+		{"while (true) { }", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"let f = fn() { f() }; f();", Limits{MaxCallDepth: 50}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 50 exceeded"},
+		{"let f = fn() { f() }; f();", Limits{}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 10000 exceeded"},
+		{"let xs = []; while (true) { xs = push(xs, 1); }", Limits{MaxAllocations: 100}, object.MEMORY_LIMIT_KIND, "allocation limit of 100 objects exceeded"},
+		{`let s = "x"; while (true) { s += s; }`, Limits{MaxAllocatedBytes: 1 << 20}, object.MEMORY_LIMIT_KIND, "allocation limit of 1048576 bytes exceeded"},
+		{"while (true) { }", Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		{"sleep(60000);", Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		{"sleep(10 ** 300);", Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		{"try { sleep(60000) } catch { 1 }", Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		// exceeding a limit cannot be caught
+		{"try { while (true) { } } catch { 1 }", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"let f = fn() { f() }; try { f() } finally { 1 };", Limits{MaxCallDepth: 50}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 50 exceeded"},
+		{"transform([1], fn(x) { while (true) { } });", Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithLimits(program, object.NewEnvironment(), tt.limits)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: expected %s %q, got=%s %q", tt.input, tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+// An operation making a value as large as its operands ask for fails before making one
+// larger than the byte limit leaves room for, rather than once it has been made
+func TestLimitsReserveBytesFirst(t *testing.T) {
+	in := NewInterpreter()
+	in.Limits = Limits{MaxAllocatedBytes: 1 << 20}
+	// made by Go, so not counted against the limit
+	if err := in.SetGlobal("big", strings.Repeat("x", 16<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetGlobal("many", make([]bool, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []string{
+		"big + big", "let s = big; s += big", "let h = {1: big}; h[1] += big", "big[0:]",
+		"many[::-1]", "concat(many, many)", "many.concat(many)",
+		`repeat("x", 1 << 28)`, `"ab".repeat(1 << 28)`, `repeat("ab", 9223372036854775807)`,
+	}
+
+	for _, input := range inputs {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := in.EvalString(input)
+		runtime.ReadMemStats(&after)
+
+		errObj, ok := err.(*object.Error)
+		if !ok || errObj.Kind != object.MEMORY_LIMIT_KIND || errObj.Message != "allocation limit of 1048576 bytes exceeded" {
+			t.Errorf("%q: expected the byte limit to be exceeded, got=%v", input, err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+			t.Errorf("%q: allocated %d bytes before failing", input, allocated)
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	input := "let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(15);"
+	limits := Limits{MaxSteps: 1000000, MaxCallDepth: 100, MaxAllocations: 100000, MaxAllocatedBytes: 1 << 20, Timeout: time.Minute}
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	testIntegerObject(t, EvalWithLimits(program, object.NewEnvironment(), limits), 610)
+}
+
+func TestEvalContext(t *testing.T) {
+	tests := []struct {
+		input           string
+		timeout         time.Duration
+		expectedKind    string
+		expectedMessage string
+	}{
+		{"while (true) { }", 0, object.CANCELLED_KIND, "evaluation cancelled: context canceled"},
+		{"let f = fn() { f() }; f();", 0, object.CANCELLED_KIND, "evaluation cancelled: context canceled"},
+		{"while (true) { }", 10 * time.Millisecond, object.TIMEOUT_KIND, "evaluation cancelled: context deadline exceeded"},
+		{"sleep(60000);", 10 * time.Millisecond, object.TIMEOUT_KIND, "evaluation cancelled: context deadline exceeded"},
+		// cancellation cannot be caught
+		{"try { while (true) { } } catch { 1 }", 10 * time.Millisecond, object.TIMEOUT_KIND, "evaluation cancelled: context deadline exceeded"},
+		{"try { sleep(60000) } catch { 1 }", 10 * time.Millisecond, object.TIMEOUT_KIND, "evaluation cancelled: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if tt.timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+		}
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: expected %s %q, got=%s %q", tt.input, tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	testNullObject(t, testEval("sleep(1);"))
+	testExpectedObject(t, `sleep("1")`, testEval(`sleep("1")`), "argument to `sleep` not supported, got STRING")
+	testExpectedObject(t, "sleep(-1)", testEval("sleep(-1)"), "cannot `sleep` for -1 milliseconds")
+	testExpectedObject(t, "sleep(-0.5)", testEval("sleep(-0.5)"), "cannot `sleep` for -0.5 milliseconds")
+	testExpectedObject(t, `sleep(float("nan"))`, testEval(`sleep(float("nan"))`), "cannot `sleep` for NaN milliseconds")
+}
+
+func TestInterpreterBuiltIns(t *testing.T) {
+	restricted := NewInterpreter()
+	restricted.Remove("print")
+	restricted.Register("len", func(args ...object.Object) object.Object {
+		return &object.String{Value: "overridden"}
+	})
+	restricted.Register("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+	})
+
+	tests := []struct {
+		interpreter *Interpreter
+		input       string
+		expected    interface{}
+	}{
+		{restricted, "double(21);", 42},
+		{restricted, `len("four");`, "overridden"},
+		{restricted, `print("hello");`, "identifier not found: print"},
+		{restricted, "transform([1, 2], double);", nil},
+		// other interpreters keep the standard built-ins
+		{NewInterpreter(), "double(21);", "identifier not found: double"},
+		{NewInterpreter(), `len("four");`, 4},
+		{NewEmptyInterpreter(), `len("four");`, "identifier not found: len"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := tt.interpreter.Eval(program, object.NewEnvironment())
+		if tt.expected == nil {
+			if evaluated.Inspect() != "[2, 4]" {
+				t.Errorf("%q: expected [2, 4], got=%s", tt.input, evaluated.Inspect())
+			}
+			continue
+		}
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+
+	testIntegerObject(t, testEval(`len("four");`), 4)
+}
+
+func TestInterpreterContextBuiltIns(t *testing.T) {
+	in := NewEmptyInterpreter()
+	in.RegisterContext("wait", func(ctx context.Context, args ...object.Object) object.Object {
+		<-ctx.Done()
+		return NULL
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	program := parser.New(lexer.New("wait();")).ParseProgram()
+	evaluated := in.EvalContext(ctx, program, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Kind != object.TIMEOUT_KIND {
+		t.Errorf("expected a %s error, got=%T (%+v)", object.TIMEOUT_KIND, evaluated, evaluated)
+	}
+}
+
+func TestInterpreterLimits(t *testing.T) {
+	in := NewInterpreter()
+	in.Limits = Limits{MaxSteps: 1000}
+
+	program := parser.New(lexer.New("while (true) { }")).ParseProgram()
+	evaluated := in.Eval(program, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Kind != object.STEP_LIMIT_KIND {
+		t.Errorf("expected a %s error, got=%T (%+v)", object.STEP_LIMIT_KIND, evaluated, evaluated)
+	}
+}
+
+func TestStreamBuiltIns(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := NewInterpreter()
+	in.Stdin = strings.NewReader("first\r\nsecond\nlast")
+	in.Stdout = &stdout
+	in.Stderr = &stderr
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"readline()", "first"},
+		{`input("? ")`, "second"},
+		{"readline()", "last"},
+		{"readline()", nil},
+		{`print(1, "two")`, nil},
+		{`eprint([3])`, nil},
+		{"readline(1)", "wrong number of arguments to `readline`: got 1"},
+		{"input(1)", "argument to `input` must be a string, but got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := in.Eval(program, object.NewEnvironment())
+		if tt.expected == nil {
+			testNullObject(t, evaluated)
+			continue
+		}
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+
+	if stdout.String() != "? 1\ntwo\n" {
+		t.Errorf("wrong output. got=%q", stdout.String())
+	}
+	if stderr.String() != "[3]\n" {
+		t.Errorf("wrong error output. got=%q", stderr.String())
+	}
+
+	// other interpreters keep their own streams
+	var other bytes.Buffer
+	otherIn := NewInterpreter()
+	otherIn.Stdout = &other
+	otherIn.Eval(parser.New(lexer.New(`print("other")`)).ParseProgram(), object.NewEnvironment())
+	if other.String() != "other\n" || stdout.String() != "? 1\ntwo\n" {
+		t.Errorf("output went to the wrong interpreter. got=%q and %q", other.String(), stdout.String())
+	}
+}
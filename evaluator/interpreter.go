@@ -0,0 +1,284 @@
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/token"
+	"io"
+	"os"
+	"slices"
+)
+
+// ContextBuiltInFunction is a built-in that may block, which must return early once ctx is done
+type ContextBuiltInFunction func(ctx context.Context, args ...object.Object) object.Object
+
+// reservingBuiltInFunction is a built-in making values as large as its arguments ask for,
+// which first reserves their bytes
+type reservingBuiltInFunction func(reserve ReserveFunc, args ...object.Object) object.Object
+
+// Interpreter evaluates programs with its own set of built-ins, so that each program
+// embedding Monkey decides what its scripts can do: one may hide `print` from untrusted
+// scripts while another adds functions of its own. Its global environment keeps the
+// bindings of the source it runs, for Go code to read and call. An Interpreter must not
+// be changed while it is evaluating a program.
+type Interpreter struct {
+	Limits Limits // applied to every evaluation
+
+	// The streams of built-ins such as `print` and `input`; nil means os.Stdin, os.Stdout
+	// and os.Stderr
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	builtIns map[string]builtIn
+	globals  *object.Environment
+
+	// Stdin buffered for reading lines, kept across calls so buffered input is not lost
+	stdinReader *bufio.Reader
+	stdinSource io.Reader
+}
+
+type builtIn struct {
+	*object.BuiltIn // the function as called outside an evaluation, such as by the VM
+
+	// For a built-in that blocks, the function an evaluation calls with its own context
+	withContext ContextBuiltInFunction
+
+	// For a built-in making values as large as its arguments ask for, the function an
+	// evaluation calls with its own ReserveFunc
+	withReserve reservingBuiltInFunction
+
+	takesCallbacks bool
+}
+
+// The standard built-ins, used by Eval and the compiler unless given an Interpreter
+var standard *Interpreter
+
+// NewInterpreter returns an Interpreter with the standard built-ins
+func NewInterpreter() *Interpreter {
+	in := &Interpreter{builtIns: make(map[string]builtIn, len(standard.builtIns)), globals: object.NewEnvironment()}
+	for name, fn := range standard.builtIns {
+		in.builtIns[name] = fn
+	}
+	in.registerStreamBuiltIns()
+	return in
+}
+
+// registerStreamBuiltIns gives the interpreter its own built-ins using its streams
+func (in *Interpreter) registerStreamBuiltIns() {
+	for name, builtIn := range streamBuiltIns {
+		in.Register(name, builtIn(in))
+	}
+}
+
+func (in *Interpreter) stdin() *bufio.Reader {
+	source := in.Stdin
+	if source == nil {
+		source = os.Stdin
+	}
+	if in.stdinReader == nil || in.stdinSource != source {
+		in.stdinReader = bufio.NewReader(source)
+		in.stdinSource = source
+	}
+	return in.stdinReader
+}
+
+func (in *Interpreter) stdout() io.Writer {
+	if in.Stdout == nil {
+		return os.Stdout
+	}
+	return in.Stdout
+}
+
+func (in *Interpreter) stderr() io.Writer {
+	if in.Stderr == nil {
+		return os.Stderr
+	}
+	return in.Stderr
+}
+
+// NewEmptyInterpreter returns an Interpreter without any built-ins
+func NewEmptyInterpreter() *Interpreter {
+	return &Interpreter{builtIns: map[string]builtIn{}, globals: object.NewEnvironment()}
+}
+
+// Register adds the built-in name, replacing any built-in of that name
+func (in *Interpreter) Register(name string, fn object.BuiltInFunction) {
+	in.builtIns[name] = builtIn{BuiltIn: &object.BuiltIn{Fn: fn}}
+}
+
+// RegisterContext adds the built-in name like Register, for a function that blocks. An
+// evaluation calls it with its own context; anywhere else it gets context.Background().
+func (in *Interpreter) RegisterContext(name string, fn ContextBuiltInFunction) {
+	in.builtIns[name] = builtIn{
+		BuiltIn: &object.BuiltIn{
+			Fn: func(args ...object.Object) object.Object {
+				return fn(context.Background(), args...)
+			},
+		},
+		withContext: fn,
+	}
+}
+
+// Remove takes away the built-in name, if there is one
+func (in *Interpreter) Remove(name string) {
+	delete(in.builtIns, name)
+}
+
+// BuiltInNames returns the names of the built-ins in a stable order, so compiled code can
+// refer to a built-in by its index.
+func (in *Interpreter) BuiltInNames() []string {
+	names := make([]string, 0, len(in.builtIns))
+	for name := range in.builtIns {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (in *Interpreter) LookupBuiltIn(name string) (*object.BuiltIn, bool) {
+	fn, ok := in.builtIns[name]
+	return fn.BuiltIn, ok
+}
+
+// BindBuiltIn is LookupBuiltIn for code running under ctx and reserve, such as on the VM: a
+// built-in that blocks, such as `sleep`, returns early once ctx is done, and one making
+// values as large as its arguments ask for, such as `concat`, first reserves their bytes
+func (in *Interpreter) BindBuiltIn(ctx context.Context, reserve ReserveFunc, name string) (*object.BuiltIn, bool) {
+	fn, ok := in.builtIns[name]
+	if !ok {
+		return nil, false
+	}
+	return fn.bind(ctx, reserve), true
+}
+
+// bind returns the built-in as called by code running under ctx and reserve
+func (fn builtIn) bind(ctx context.Context, reserve ReserveFunc) *object.BuiltIn {
+	switch {
+	case fn.withContext != nil:
+		return &object.BuiltIn{
+			Fn: func(args ...object.Object) object.Object {
+				return fn.withContext(ctx, args...)
+			},
+		}
+	case fn.withReserve != nil:
+		return &object.BuiltIn{
+			Fn: func(args ...object.Object) object.Object {
+				return fn.withReserve(reserve, args...)
+			},
+		}
+	default:
+		return fn.BuiltIn
+	}
+}
+
+// TakesCallbacks reports whether the built-in name calls functions passed to it
+func (in *Interpreter) TakesCallbacks(name string) bool {
+	return in.builtIns[name].takesCallbacks
+}
+
+// Eval evaluates node in env like the package's Eval, with this interpreter's built-ins and limits
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	return in.EvalContext(context.Background(), node, env)
+}
+
+// EvalContext is Eval, aborting with an error once ctx is done
+func (in *Interpreter) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return in.eval(ctx, node, env, in.Limits)
+}
+
+func (in *Interpreter) eval(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Message: fmt.Sprintf("internal error: %v", r), Kind: object.INTERNAL_ERROR_KIND, Pos: node.Pos()}
+		}
+	}()
+
+	e, cancel := newEvaluation(ctx, in, limits)
+	defer cancel()
+	return e.evalNode(node, env)
+}
+
+// Globals returns the environment EvalString runs source in
+func (in *Interpreter) Globals() *object.Environment {
+	return in.globals
+}
+
+// Global returns the value source run by EvalString bound to name
+func (in *Interpreter) Global(name string) (object.Object, bool) {
+	return in.globals.Get(name)
+}
+
+// SetGlobal binds name to value, converted as by ToObject, for source run by EvalString
+func (in *Interpreter) SetGlobal(name string, value interface{}) error {
+	obj, err := in.ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.globals.Set(name, obj)
+	return nil
+}
+
+// EvalString parses and evaluates source in the global environment, returning the value of
+// its last statement, or NULL if it has none. Syntax errors and the Monkey error the program
+// fails with, an *object.Error, are returned as errors.
+func (in *Interpreter) EvalString(source string) (object.Object, error) {
+	return in.EvalStringContext(context.Background(), source)
+}
+
+// EvalStringContext is EvalString, aborting with an error once ctx is done
+func (in *Interpreter) EvalStringContext(ctx context.Context, source string) (object.Object, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		errs := make([]error, len(p.ParseErrors()))
+		for i, err := range p.ParseErrors() {
+			errs[i] = err
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	return splitError(in.EvalContext(ctx, program, in.globals))
+}
+
+// Call calls the Monkey function fn with args, which are converted as by ToObject. An error
+// the function fails with is returned as an *object.Error.
+func (in *Interpreter) Call(fn object.Object, args ...interface{}) (object.Object, error) {
+	return in.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is Call, aborting with an error once ctx is done
+func (in *Interpreter) CallContext(ctx context.Context, fn object.Object, args ...interface{}) (object.Object, error) {
+	return in.callWith(func(fn object.Object, args []object.Object) object.Object {
+		return in.call(ctx, fn, args)
+	}, fn, args)
+}
+
+func (in *Interpreter) call(ctx context.Context, fn object.Object, args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Message: fmt.Sprintf("internal error: %v", r), Kind: object.INTERNAL_ERROR_KIND}
+		}
+	}()
+
+	e, cancel := newEvaluation(ctx, in, in.Limits)
+	defer cancel()
+	return e.applyFunction(fn, args, token.Position{})
+}
+
+// splitError separates a Monkey error from a value
+func splitError(obj object.Object) (object.Object, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+	if obj == nil {
+		return NULL, nil
+	}
+	return obj, nil
+}
@@ -0,0 +1,172 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxCallDepth keeps unbounded recursion from overflowing the Go stack
+const DefaultMaxCallDepth = 10000
+
+// Limits caps what a single evaluation may use, for running untrusted scripts. A zero field
+// means no limit, except MaxCallDepth, which then is DefaultMaxCallDepth.
+type Limits struct {
+	MaxSteps          int64 // nodes evaluated
+	MaxCallDepth      int   // nested calls of Monkey functions
+	MaxAllocations    int64 // objects allocated, whether or not they are still in use
+	MaxAllocatedBytes int64 // the approximate size of those objects
+	Timeout           time.Duration
+}
+
+// The deadline is only checked every so many steps, since reading the clock is slow
+const stepsPerDeadlineCheck = 1024
+
+// step counts a node about to be evaluated against the step limit and the timeout
+func (e *evaluation) step() *object.Error {
+	e.steps++
+
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return e.abort(object.STEP_LIMIT_KIND, "step limit of %d exceeded", e.limits.MaxSteps)
+	}
+	if !e.deadline.IsZero() && e.steps%stepsPerDeadlineCheck == 0 && time.Now().After(e.deadline) {
+		return e.abort(object.TIMEOUT_KIND, "timeout of %s exceeded", e.limits.Timeout)
+	}
+	return nil
+}
+
+func (e *evaluation) limitsAllocations() bool {
+	return e.limits.MaxAllocations > 0 || e.limits.MaxAllocatedBytes > 0
+}
+
+// allocates reports whether evaluating node creates a new object. Calls are counted too,
+// since built-ins such as `push` allocate, although a Monkey function may return an
+// existing object.
+func allocates(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.ArrayLiteral, *ast.HashLiteral,
+		*ast.FunctionLiteral, *ast.PrefixExpression, *ast.InfixExpression, *ast.AssignExpression,
+		*ast.CallExpression, *ast.MethodCallExpression, *ast.SliceExpression:
+		return true
+	}
+	return false
+}
+
+// allocate counts obj against the allocation limits
+func (e *evaluation) allocate(obj object.Object) *object.Error {
+	switch obj.(type) {
+	case nil, *object.Boolean, *object.Null, *object.Error:
+		return nil
+	}
+
+	e.objects++
+	e.bytes += SizeOf(obj)
+
+	if e.limits.MaxAllocations > 0 && e.objects > e.limits.MaxAllocations {
+		return e.abort(object.MEMORY_LIMIT_KIND, "allocation limit of %d objects exceeded", e.limits.MaxAllocations)
+	}
+	if e.limits.MaxAllocatedBytes > 0 && e.bytes > e.limits.MaxAllocatedBytes {
+		return e.abort(object.MEMORY_LIMIT_KIND, "allocation limit of %d bytes exceeded", e.limits.MaxAllocatedBytes)
+	}
+	return nil
+}
+
+// A ReserveFunc checks, before a value of the given size in bytes is made, that the byte
+// limit of the evaluation making it leaves room for it, failing with the limit's error if
+// not. The value is counted once it is made, like any other.
+type ReserveFunc func(bytes int64) *object.Error
+
+// noReserve is the ReserveFunc of built-ins called outside any evaluation
+func noReserve(int64) *object.Error { return nil }
+
+// reserve is the ReserveFunc of the evaluation, which operations making values as large as
+// their operands ask for call first, so that a single one cannot allocate far past
+// MaxAllocatedBytes before allocate notices
+func (e *evaluation) reserve(bytes int64) *object.Error {
+	if e.limits.MaxAllocatedBytes > 0 && bytes > e.limits.MaxAllocatedBytes-e.bytes {
+		return e.abort(object.MEMORY_LIMIT_KIND, "allocation limit of %d bytes exceeded", e.limits.MaxAllocatedBytes)
+	}
+	return nil
+}
+
+// InfixSize estimates the bytes the result of left operator right takes up, where that
+// grows with the operands, as when joining strings, and is 0 otherwise. With
+// IndexAssignmentSize and SliceSize, it lets an engine reserve the bytes beforehand.
+func InfixSize(operator string, left, right object.Object) int64 {
+	leftString, leftOk := left.(*object.String)
+	rightString, rightOk := right.(*object.String)
+	if operator != "+" || !leftOk || !rightOk {
+		return 0
+	}
+	return 16 + int64(len(leftString.Value)) + int64(len(rightString.Value))
+}
+
+// IndexAssignmentSize is InfixSize for assigning value to left[index] with an operator such
+// as "+="
+func IndexAssignmentSize(operator string, left, index, value object.Object) int64 {
+	if operator == "=" {
+		return 0
+	}
+	current := evalIndexExpression(left, index)
+	if isError(current) {
+		return 0
+	}
+	return InfixSize(strings.TrimSuffix(operator, "="), current, value)
+}
+
+// SliceSize estimates the bytes left[start:end:step] takes up, at most
+func SliceSize(left, start, end, step object.Object) int64 {
+	from, to, stepBy, err := sliceRange(left, start, end, step)
+	if err != nil {
+		return 0
+	}
+	count := sliceCount(from, to, stepBy)
+	if str, ok := left.(*object.String); ok {
+		return 16 + min(int64(len(str.Value)), utf8.UTFMax*count)
+	}
+	return 24 + 16*count
+}
+
+// SizeOf estimates the bytes obj takes up, not counting the objects it refers to, as
+// MaxAllocatedBytes counts them
+func SizeOf(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.String:
+		return 16 + int64(len(obj.Value))
+	case *object.Array:
+		return 24 + 16*int64(len(obj.Elements))
+	case *object.Hash:
+		return 48 + 64*int64(len(obj.Pairs))
+	case *object.BigInt:
+		return 32 + 8*int64(len(obj.Value.Bits()))
+	default:
+		return 16
+	}
+}
+
+// checkCancelled aborts the evaluation once its context is done, or its timeout has passed
+func (e *evaluation) checkCancelled() *object.Error {
+	select {
+	case <-e.done:
+		if !e.deadline.IsZero() && !time.Now().Before(e.deadline) {
+			return e.abort(object.TIMEOUT_KIND, "timeout of %s exceeded", e.limits.Timeout)
+		}
+		if errors.Is(e.ctx.Err(), context.DeadlineExceeded) {
+			return e.abort(object.TIMEOUT_KIND, "evaluation cancelled: %s", e.ctx.Err())
+		}
+		return e.abort(object.CANCELLED_KIND, "evaluation cancelled: %s", e.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// abort ends the evaluation with an error of the given kind
+func (e *evaluation) abort(kind string, format string, a ...interface{}) *object.Error {
+	e.aborted = &object.Error{Message: fmt.Sprintf(format, a...), Kind: kind}
+	return e.aborted
+}
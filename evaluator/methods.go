@@ -0,0 +1,354 @@
+package evaluator
+
+import (
+	"context"
+	"interpreter/object"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// methods holds, for each type, the methods called as `receiver.name(args)`. A method
+// gets the receiver as its first argument, so a call to a method its type lacks falls back
+// to the built-in of that name: `xs.push(1)` is `push(xs, 1)`.
+var methods map[object.ObjectType]map[string]builtIn
+
+func init() {
+	// Set in init, since methods calling back into functions lead back to methods
+	methods = map[object.ObjectType]map[string]builtIn{
+		object.ARRAY_OBJ: {
+			"first":    method(arrayFirst),
+			"last":     method(arrayLast),
+			"rest":     method(arrayRest),
+			"contains": method(arrayContains),
+			"map":      callbackMethod(arrayMap),
+			"filter":   callbackMethod(arrayFilter),
+			"reduce":   callbackMethod(arrayReduce),
+		},
+		object.STRING_OBJ: {
+			"reverse": method(stringReverse),
+			"lines":   method(stringLines),
+			"words":   method(stringWords),
+		},
+		object.HASH_OBJ: {
+			"keys":   method(hashKeys),
+			"values": method(hashValues),
+			"has":    method(hashHas),
+			"get":    method(hashGet),
+		},
+		object.INTEGER_OBJ: {
+			"abs":      method(integerAbs),
+			"sign":     method(integerSign),
+			"toString": method(integerToString),
+		},
+	}
+}
+
+func method(fn object.BuiltInFunction) builtIn {
+	return builtIn{BuiltIn: &object.BuiltIn{Fn: fn}}
+}
+
+func callbackMethod(fn object.BuiltInFunction) builtIn {
+	return builtIn{BuiltIn: &object.BuiltIn{Fn: fn}, takesCallbacks: true}
+}
+
+// lookupMethod finds the method name of receiver in the method table of its type, or else
+// among builtIns
+func lookupMethod(builtIns map[string]builtIn, receiver object.Object, name string) (builtIn, bool) {
+	if fn, ok := methods[receiver.Type()][name]; ok {
+		return fn, true
+	}
+	fn, ok := builtIns[name]
+	return fn, ok
+}
+
+// LookupMethod returns the method name of receiver, to be called with the receiver as its
+// first argument: the one the receiver's type has, or else the interpreter's built-in of
+// that name. It also reports whether the method calls functions passed to it.
+func (in *Interpreter) LookupMethod(receiver object.Object, name string) (fn *object.BuiltIn, takesCallbacks bool, ok bool) {
+	method, ok := lookupMethod(in.builtIns, receiver, name)
+	return method.BuiltIn, method.takesCallbacks, ok
+}
+
+// BindMethod is LookupMethod for code running under ctx and reserve, as BindBuiltIn is
+// LookupBuiltIn
+func (in *Interpreter) BindMethod(ctx context.Context, reserve ReserveFunc, receiver object.Object, name string) (fn *object.BuiltIn, takesCallbacks bool, ok bool) {
+	method, ok := lookupMethod(in.builtIns, receiver, name)
+	if !ok {
+		return nil, false, false
+	}
+	return method.bind(ctx, reserve), method.takesCallbacks, true
+}
+
+func (e *evaluation) callMethod(receiver object.Object, name string, args []object.Object) object.Object {
+	method, ok := lookupMethod(e.builtIns, receiver, name)
+	if !ok {
+		return newError("undefined method %s for %s", name, receiver.Type())
+	}
+	return e.bindBuiltIn(method).Fn(append([]object.Object{receiver}, args...)...)
+}
+
+// wrongMethodArguments reports a method called with the wrong number of arguments, not
+// counting the receiver
+func wrongMethodArguments(name string, args []object.Object) *object.Error {
+	return newError("wrong number of arguments to `%s`: got %d", name, len(args)-1)
+}
+
+func isFunction(obj object.Object) bool {
+	return obj.Type() == object.FUNCTION_OBJ || obj.Type() == object.BUILT_IN_OBJ
+}
+
+func arrayFirst(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("first", args)
+	}
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return NULL
+	}
+	return elements[0]
+}
+
+func arrayLast(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("last", args)
+	}
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return NULL
+	}
+	return elements[len(elements)-1]
+}
+
+// arrayRest returns a new array of every element but the first
+func arrayRest(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("rest", args)
+	}
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return NULL
+	}
+	return &object.Array{Elements: slices.Clone(elements[1:])}
+}
+
+func arrayContains(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongMethodArguments("contains", args)
+	}
+	for _, element := range args[0].(*object.Array).Elements {
+		if object.Equal(element, args[1]) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+func arrayMap(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongMethodArguments("map", args)
+	}
+	if !isFunction(args[1]) {
+		return newError("argument to `map` must be a function, but got %s", args[1].Type())
+	}
+
+	elements := args[0].(*object.Array).Elements
+	mapped := make([]object.Object, 0, len(elements))
+	for _, element := range elements {
+		value := callFunction(args[1], []object.Object{element})
+		if isError(value) {
+			return value
+		}
+		mapped = append(mapped, value)
+	}
+	return &object.Array{Elements: mapped}
+}
+
+// arrayFilter returns a new array of the elements the function returns a truthy value for
+func arrayFilter(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongMethodArguments("filter", args)
+	}
+	if !isFunction(args[1]) {
+		return newError("argument to `filter` must be a function, but got %s", args[1].Type())
+	}
+
+	kept := []object.Object{}
+	for _, element := range args[0].(*object.Array).Elements {
+		keep := callFunction(args[1], []object.Object{element})
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			kept = append(kept, element)
+		}
+	}
+	return &object.Array{Elements: kept}
+}
+
+// arrayReduce combines the elements from the left with a function of the result so far and
+// the next element, starting from the initial value if there is one, or else the first element
+func arrayReduce(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongMethodArguments("reduce", args)
+	}
+	if !isFunction(args[1]) {
+		return newError("argument 1 to `reduce` must be a function, but got %s", args[1].Type())
+	}
+
+	elements := args[0].(*object.Array).Elements
+	var result object.Object
+	if len(args) == 3 {
+		result = args[2]
+	} else if len(elements) == 0 {
+		return newError("cannot `reduce` an empty array without an initial value")
+	} else {
+		result, elements = elements[0], elements[1:]
+	}
+
+	for _, element := range elements {
+		result = callFunction(args[1], []object.Object{result, element})
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// stringReverse reverses the characters of a string, rather than its bytes
+func stringReverse(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("reverse", args)
+	}
+	runes := []rune(args[0].(*object.String).Value)
+	slices.Reverse(runes)
+	return &object.String{Value: string(runes)}
+}
+
+// stringLines splits a string into its lines, without their line breaks
+func stringLines(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("lines", args)
+	}
+	value := args[0].(*object.String).Value
+	if value == "" {
+		return &object.Array{Elements: []object.Object{}}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+	elements := make([]object.Object, len(lines))
+	for i, line := range lines {
+		elements[i] = &object.String{Value: strings.TrimSuffix(line, "\r")}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// stringWords splits a string around runs of white space
+func stringWords(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("words", args)
+	}
+	words := strings.Fields(args[0].(*object.String).Value)
+	elements := make([]object.Object, len(words))
+	for i, word := range words {
+		elements[i] = &object.String{Value: word}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// hashKeys returns the keys of a hash, in the order a for loop visits them
+func hashKeys(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("keys", args)
+	}
+	pairs := args[0].(*object.Hash).SortedPairs()
+	keys := make([]object.Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return &object.Array{Elements: keys}
+}
+
+// hashValues returns the values of a hash, in the order of their keys
+func hashValues(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("values", args)
+	}
+	pairs := args[0].(*object.Hash).SortedPairs()
+	values := make([]object.Object, len(pairs))
+	for i, pair := range pairs {
+		values[i] = pair.Value
+	}
+	return &object.Array{Elements: values}
+}
+
+func hashHas(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongMethodArguments("has", args)
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	_, ok = args[0].(*object.Hash).Pairs[key.HashKey()]
+	return boolToBoolObject(ok)
+}
+
+// hashGet looks up a key like indexing does, but returns the default given, if any, rather
+// than null for a missing key
+func hashGet(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongMethodArguments("get", args)
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	if pair, ok := args[0].(*object.Hash).Pairs[key.HashKey()]; ok {
+		return pair.Value
+	}
+	if len(args) == 3 {
+		return args[2]
+	}
+	return NULL
+}
+
+func integerAbs(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("abs", args)
+	}
+	if integer, ok := args[0].(*object.Integer); ok && integer.Value >= 0 {
+		return integer
+	}
+	value, _ := object.BigValue(args[0])
+	return object.IntegerFromBig(new(big.Int).Abs(value))
+}
+
+// integerSign returns -1, 0 or 1 as an integer is negative, zero or positive
+func integerSign(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongMethodArguments("sign", args)
+	}
+	value, _ := object.BigValue(args[0])
+	return &object.Integer{Value: int64(value.Sign())}
+}
+
+// integerToString writes an integer in base 10, or the base given, from 2 to 36
+func integerToString(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongMethodArguments("toString", args)
+	}
+	base := big.NewInt(10)
+	if len(args) == 2 {
+		var ok bool
+		if base, ok = object.BigValue(args[1]); !ok {
+			return newError("argument to `toString` must be an integer, but got %s", args[1].Type())
+		}
+	}
+	if base.Cmp(big.NewInt(2)) < 0 || base.Cmp(big.NewInt(36)) > 0 {
+		return newError("base must be from 2 to 36, got %s", base)
+	}
+
+	value, _ := object.BigValue(args[0])
+	return &object.String{Value: value.Text(int(base.Int64()))}
+}
@@ -0,0 +1,448 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/object"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// The string built-ins. Like every built-in, each is also a method of its first argument,
+// so `split(s, ",")` may be written `s.split(",")`. They count characters, not bytes: `indexOf`
+// returns the index of a character, as indexing a string takes.
+var stringBuiltIns = map[string]*object.BuiltIn{
+	"split":      {Fn: stringSplit},
+	"join":       {Fn: stringJoin},
+	"trim":       {Fn: stringTrim},
+	"upper":      {Fn: stringUpper},
+	"lower":      {Fn: stringLower},
+	"replace":    {Fn: stringReplace},
+	"contains":   {Fn: stringContains},
+	"startsWith": {Fn: stringStartsWith},
+	"endsWith":   {Fn: stringEndsWith},
+	"indexOf":    {Fn: stringIndexOf},
+	"chars":      {Fn: stringChars},
+	"runeLen":    {Fn: stringRuneLen},
+	"format":     {Fn: stringFormat},
+	"ord":        {Fn: stringOrd},
+	"chr":        {Fn: stringChr},
+}
+
+// maxStringBytes bounds the strings `repeat` makes without a byte limit, which could
+// otherwise ask for more memory than there is. With one, what is left of it is the bound.
+const maxStringBytes = 1 << 30
+
+// stringArgument returns argument i of the built-in name, which must be a string
+func stringArgument(name string, args []object.Object, i int) (string, *object.Error) {
+	str, ok := args[i].(*object.String)
+	if !ok {
+		return "", argumentError(name, args, i, "a string")
+	}
+	return str.Value, nil
+}
+
+// integerArgument returns argument i of the built-in name, which must be an integer, with a
+// BigInt as the nearest int64, since it is out of range of any string
+func integerArgument(name string, args []object.Object, i int) (int64, *object.Error) {
+	if integer, ok := args[i].(*object.Integer); ok {
+		return integer.Value, nil
+	}
+	value, ok := object.BigValue(args[i])
+	if !ok {
+		return 0, argumentError(name, args, i, "an integer")
+	}
+	if value.Sign() < 0 {
+		return math.MinInt64, nil
+	}
+	return math.MaxInt64, nil
+}
+
+func argumentError(name string, args []object.Object, i int, expected string) *object.Error {
+	if len(args) == 1 {
+		return newError("argument to `%s` must be %s, but got %s", name, expected, args[i].Type())
+	}
+	return newError("argument %d to `%s` must be %s, but got %s", i+1, name, expected, args[i].Type())
+}
+
+func stringsToArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, value := range values {
+		elements[i] = &object.String{Value: value}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// stringSplit splits a string around each occurrence of a separator, or into its characters
+// if the separator is empty
+func stringSplit(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `split`: got %d", len(args))
+	}
+	str, err := stringArgument("split", args, 0)
+	if err != nil {
+		return err
+	}
+	sep, err := stringArgument("split", args, 1)
+	if err != nil {
+		return err
+	}
+	return stringsToArray(strings.Split(str, sep))
+}
+
+// stringJoin joins an array of strings, with a separator between them if one is given
+func stringJoin(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to `join`: got %d", len(args))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return argumentError("join", args, 0, "an array")
+	}
+	sep := ""
+	if len(args) == 2 {
+		var err *object.Error
+		if sep, err = stringArgument("join", args, 1); err != nil {
+			return err
+		}
+	}
+
+	values := make([]string, len(array.Elements))
+	for i, element := range array.Elements {
+		str, ok := element.(*object.String)
+		if !ok {
+			return newError("cannot `join` %s element %d, only strings", element.Type(), i)
+		}
+		values[i] = str.Value
+	}
+	return &object.String{Value: strings.Join(values, sep)}
+}
+
+// stringTrim removes white space from both ends of a string, or else any of the characters
+// of the string given
+func stringTrim(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to `trim`: got %d", len(args))
+	}
+	str, err := stringArgument("trim", args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return &object.String{Value: strings.TrimSpace(str)}
+	}
+	cutset, err := stringArgument("trim", args, 1)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.Trim(str, cutset)}
+}
+
+func stringUpper(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `upper`: got %d", len(args))
+	}
+	str, err := stringArgument("upper", args, 0)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToUpper(str)}
+}
+
+func stringLower(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `lower`: got %d", len(args))
+	}
+	str, err := stringArgument("lower", args, 0)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToLower(str)}
+}
+
+// stringReplace replaces every occurrence of old in a string with new, or only the first n
+// if n is given
+func stringReplace(args ...object.Object) object.Object {
+	if len(args) != 3 && len(args) != 4 {
+		return newError("wrong number of arguments to `replace`: got %d", len(args))
+	}
+	var strs [3]string
+	for i := range strs {
+		var err *object.Error
+		if strs[i], err = stringArgument("replace", args, i); err != nil {
+			return err
+		}
+	}
+	n := int64(-1)
+	if len(args) == 4 {
+		var err *object.Error
+		if n, err = integerArgument("replace", args, 3); err != nil {
+			return err
+		}
+		if n < 0 {
+			return newError("cannot `replace` a negative number of times: %s", args[3].Inspect())
+		}
+	}
+	return &object.String{Value: strings.Replace(strs[0], strs[1], strs[2], int(min(n, math.MaxInt)))}
+}
+
+// stringContains reports whether a string contains another. Called on an array, it is the
+// array's `contains` method.
+func stringContains(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `contains`: got %d", len(args))
+	}
+	if args[0].Type() == object.ARRAY_OBJ {
+		return arrayContains(args...)
+	}
+	return stringTest("contains", strings.Contains, args)
+}
+
+func stringStartsWith(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `startsWith`: got %d", len(args))
+	}
+	return stringTest("startsWith", strings.HasPrefix, args)
+}
+
+func stringEndsWith(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `endsWith`: got %d", len(args))
+	}
+	return stringTest("endsWith", strings.HasSuffix, args)
+}
+
+// stringTest applies test to the two string arguments of the built-in name
+func stringTest(name string, test func(s, substr string) bool, args []object.Object) object.Object {
+	str, err := stringArgument(name, args, 0)
+	if err != nil {
+		return err
+	}
+	substr, err := stringArgument(name, args, 1)
+	if err != nil {
+		return err
+	}
+	return boolToBoolObject(test(str, substr))
+}
+
+// stringIndexOf returns the index of the character a substring first starts at, or -1 if
+// the string does not contain it
+func stringIndexOf(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `indexOf`: got %d", len(args))
+	}
+	str, err := stringArgument("indexOf", args, 0)
+	if err != nil {
+		return err
+	}
+	substr, err := stringArgument("indexOf", args, 1)
+	if err != nil {
+		return err
+	}
+	i := strings.Index(str, substr)
+	if i < 0 {
+		return &object.Integer{Value: -1}
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(str[:i]))}
+}
+
+func stringRepeat(reserve ReserveFunc, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `repeat`: got %d", len(args))
+	}
+	str, err := stringArgument("repeat", args, 0)
+	if err != nil {
+		return err
+	}
+	count, err := integerArgument("repeat", args, 1)
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return newError("cannot `repeat` a negative number of times: %s", args[1].Inspect())
+	}
+	size := int64(math.MaxInt64)
+	if len(str) == 0 || count <= (math.MaxInt64-16)/int64(len(str)) {
+		size = 16 + int64(len(str))*count
+	}
+	if err := reserve(size); err != nil {
+		return err
+	}
+	if len(str) > 0 && count > maxStringBytes/int64(len(str)) {
+		return newError("string too long: `repeat` would make more than %d bytes", maxStringBytes)
+	}
+	return &object.String{Value: strings.Repeat(str, int(count))}
+}
+
+// stringChars splits a string into its characters, each a string of its own
+func stringChars(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `chars`: got %d", len(args))
+	}
+	str, err := stringArgument("chars", args, 0)
+	if err != nil {
+		return err
+	}
+	return stringsToArray(strings.Split(str, ""))
+}
+
+// stringRuneLen counts the characters of a string, where `len` counts its bytes
+func stringRuneLen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `runeLen`: got %d", len(args))
+	}
+	str, err := stringArgument("runeLen", args, 0)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(str))}
+}
+
+// stringOrd returns the code point of a single character
+func stringOrd(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `ord`: got %d", len(args))
+	}
+	str, err := stringArgument("ord", args, 0)
+	if err != nil {
+		return err
+	}
+	r, size := utf8.DecodeRuneInString(str)
+	if size == 0 || size != len(str) {
+		return newError("argument to `ord` must be a single character, but got %q", str)
+	}
+	return &object.Integer{Value: int64(r)}
+}
+
+// stringChr returns the character of a code point, as a string
+func stringChr(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `chr`: got %d", len(args))
+	}
+	code, err := integerArgument("chr", args, 0)
+	if err != nil {
+		return err
+	}
+	if code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+		return newError("%s is not a valid Unicode code point", args[0].Inspect())
+	}
+	return &object.String{Value: string(rune(code))}
+}
+
+// stringFormat formats its arguments as the directives of a template say, as Go's
+// fmt.Sprintf does: each directive is a %, then any of the flags `+-# 0`, an optional width
+// and .precision, and a verb, or else %% for a percent sign. The verbs are %v and %s for any
+// value, %q for a quoted one, %d %b %o %x %X %c and %U for integers, %e %E %f %F %g and %G
+// for numbers, and %t for booleans; %x and %X also write strings in hexadecimal. Widths
+// count characters, not bytes.
+func stringFormat(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to `format`: got 0")
+	}
+	template, err := stringArgument("format", args, 0)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	next := 1
+	for i := 0; i < len(template); {
+		if template[i] != '%' {
+			out.WriteByte(template[i])
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(template) && strings.IndexByte("+-# 0", template[end]) >= 0 {
+			end++
+		}
+		for end < len(template) && isDigit(template[end]) {
+			end++
+		}
+		if end < len(template) && template[end] == '.' {
+			end++
+			for end < len(template) && isDigit(template[end]) {
+				end++
+			}
+		}
+		if end == len(template) {
+			return newError("`format` directive %q has no verb", template[i:])
+		}
+		verb, size := utf8.DecodeRuneInString(template[end:])
+		directive := template[i : end+size]
+		i = end + size
+
+		if verb == '%' {
+			if directive != "%%" {
+				return newError("`format` directive %q takes no flags, width or precision", directive)
+			}
+			out.WriteByte('%')
+			continue
+		}
+		if next == len(args) {
+			return newError("not enough arguments to `format`: no value for %s", directive)
+		}
+		value, err := formatValue(directive, verb, args, next)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&out, directive, value)
+		next++
+	}
+
+	if next < len(args) {
+		return newError("too many arguments to `format`: %d left over", len(args)-next)
+	}
+	return &object.String{Value: out.String()}
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// formatValue converts argument i of `format` to the Go value that fmt formats with verb as
+// Monkey would
+func formatValue(directive string, verb rune, args []object.Object, i int) (any, *object.Error) {
+	arg := args[i]
+	mismatch := func(expected string) *object.Error {
+		return newError("argument %d to `format` must be %s for %s, but got %s", i+1, expected, directive, arg.Type())
+	}
+
+	switch verb {
+	case 'v', 's', 'q':
+		if str, ok := arg.(*object.String); ok {
+			return str.Value, nil
+		}
+		return arg.Inspect(), nil
+	case 'd', 'b', 'o', 'x', 'X', 'c', 'U':
+		switch arg := arg.(type) {
+		case *object.Integer:
+			return arg.Value, nil
+		case *object.BigInt:
+			if verb == 'c' || verb == 'U' {
+				return nil, newError("%s is not a valid Unicode code point", arg.Inspect())
+			}
+			return arg.Value, nil
+		case *object.String:
+			if verb == 'x' || verb == 'X' {
+				return arg.Value, nil
+			}
+		}
+		if verb == 'x' || verb == 'X' {
+			return nil, mismatch("an integer or a string")
+		}
+		return nil, mismatch("an integer")
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		if !isNumber(arg) {
+			return nil, mismatch("a number")
+		}
+		return toFloat(arg), nil
+	case 't':
+		if boolean, ok := arg.(*object.Boolean); ok {
+			return boolean.Value, nil
+		}
+		return nil, mismatch("a boolean")
+	}
+	return nil, newError("unknown `format` verb %q in %s", verb, directive)
+}
@@ -1,26 +1,57 @@
 package lexer
 
 import (
+	"fmt"
 	"interpreter/token"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
 type Lexer struct {
 	input         string
+	filename      string
 	position      int  // current position in input
 	readPosition  int  // next position in input
 	currentSymbol rune // current symbol under examination
+	line          int  // line of the current symbol
+	column        int  // column of the current symbol, in runes
+	emitComments  bool
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile is like New, but token positions also name the file the input came from
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readSymbol()
+	l.skipShebang()
 	return l
 }
 
+// skipShebang skips a `#!` interpreter line at the very start of a script
+func (l *Lexer) skipShebang() {
+	if !strings.HasPrefix(l.input, "#!") {
+		return
+	}
+	for l.currentSymbol != '\n' && l.currentSymbol != 0 {
+		l.readSymbol()
+	}
+}
+
 func (l *Lexer) readSymbol() {
+	if l.currentSymbol == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.currentSymbol = 0
+		l.position = len(l.input)
 	} else {
 		// Decode the next rune from the input
 		var size int
@@ -30,48 +61,97 @@ func (l *Lexer) readSymbol() {
 	}
 }
 
+// EmitComments makes NextToken return comments as COMMENT tokens rather than skip them,
+// for tools that keep them, such as a formatter
+func (l *Lexer) EmitComments() {
+	l.emitComments = true
+}
+
+// Input returns the source being tokenized, for quoting it in error messages
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.position, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	for l.currentSymbol == '/' && (l.peekSymbol() == '/' || l.peekSymbol() == '*') {
+		pos := l.currentPosition()
+		comment, terminated := l.readComment()
+		if !terminated {
+			return token.Token{Type: token.ERROR, Literal: "unterminated comment", Pos: pos}
+		}
+		if l.emitComments {
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos}
+		}
+		l.skipWhitespace()
+	}
+	pos := l.currentPosition()
 
 	switch l.currentSymbol {
 	case '=':
 		if l.peekSymbol() == '=' {
-			symbol := l.currentSymbol
-			l.readSymbol()
-			tok = token.Token{Type: token.EQ, Literal: string(symbol) + string(l.currentSymbol)}
+			tok = l.newTwoSymbolToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, l.currentSymbol)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.currentSymbol)
+		tok = l.newAssignableToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.currentSymbol)
+		tok = l.newAssignableToken(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		if l.peekSymbol() == '=' {
-			symbol := l.currentSymbol
-			l.readSymbol()
-			tok = token.Token{Type: token.NOT_EQ, Literal: string(symbol) + string(l.currentSymbol)}
+			tok = l.newTwoSymbolToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.currentSymbol)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.currentSymbol)
+		tok = l.newAssignableToken(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		if l.peekSymbol() == '=' {
-			symbol := l.currentSymbol
-			l.readSymbol()
-			tok = token.Token{Type: token.DOUBLE_ASTERISK, Literal: string(symbol) + string(l.currentSymbol)}
+		if l.peekSymbol() == '*' {
+			tok = l.newTwoSymbolToken(token.DOUBLE_ASTERISK)
 		} else {
-			tok = newToken(token.ASTERISK, l.currentSymbol)
+			tok = l.newAssignableToken(token.ASTERISK, token.ASTERISK_ASSIGN)
 		}
 	case '^':
 		tok = newToken(token.CARET, l.currentSymbol)
+	case '~':
+		tok = newToken(token.TILDE, l.currentSymbol)
+	case '&':
+		if l.peekSymbol() == '&' {
+			tok = l.newTwoSymbolToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.currentSymbol)
+		}
+	case '|':
+		if l.peekSymbol() == '|' {
+			tok = l.newTwoSymbolToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.currentSymbol)
+		}
 	case '<':
-		tok = newToken(token.LT, l.currentSymbol)
+		switch l.peekSymbol() {
+		case '=':
+			tok = l.newTwoSymbolToken(token.LT_EQ)
+		case '<':
+			tok = l.newTwoSymbolToken(token.SHIFT_LEFT)
+		default:
+			tok = newToken(token.LT, l.currentSymbol)
+		}
 	case '>':
-		tok = newToken(token.GT, l.currentSymbol)
+		switch l.peekSymbol() {
+		case '=':
+			tok = l.newTwoSymbolToken(token.GT_EQ)
+		case '>':
+			tok = l.newTwoSymbolToken(token.SHIFT_RIGHT)
+		default:
+			tok = newToken(token.GT, l.currentSymbol)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.currentSymbol)
 	case ',':
@@ -93,23 +173,30 @@ func (l *Lexer) NextToken() token.Token {
 	case '🦖':
 		tok = newToken(token.EMOJI_TREE, l.currentSymbol)
 	case '%':
-		tok = newToken(token.MODULUS, l.currentSymbol)
+		tok = l.newAssignableToken(token.MODULUS, token.MODULUS_ASSIGN)
 	case ':':
 		tok = newToken(token.COLON, l.currentSymbol)
+	case '.':
+		if isDigit(rune(l.peekSymbol())) {
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos = pos
+			return tok
+		}
+		tok = newToken(token.PERIOD, l.currentSymbol)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
-	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+	case '"', '`':
+		return l.readString(pos)
 	default:
 		if isLetter(l.currentSymbol) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.currentSymbol) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else if isEmoji(l.currentSymbol) {
 			tok.Type = token.EMOJI
@@ -120,6 +207,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readSymbol()
+	tok.Pos = pos
 	return tok
 }
 
@@ -127,6 +215,22 @@ func newToken(tokenType token.TokenType, symbol rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(symbol)}
 }
 
+// newTwoSymbolToken reads an operator spelled with the current symbol and the next one
+func (l *Lexer) newTwoSymbolToken(tokenType token.TokenType) token.Token {
+	symbol := l.currentSymbol
+	l.readSymbol()
+	return token.Token{Type: tokenType, Literal: string(symbol) + string(l.currentSymbol)}
+}
+
+// newAssignableToken reads an operator that may be followed by `=` to form a compound
+// assignment, such as `+` and `+=`
+func (l *Lexer) newAssignableToken(operator, assignment token.TokenType) token.Token {
+	if l.peekSymbol() != '=' {
+		return newToken(operator, l.currentSymbol)
+	}
+	return l.newTwoSymbolToken(assignment)
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.currentSymbol) {
@@ -155,12 +259,40 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float such as `3.14`, `.5` or `1e-9`
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
+	if l.currentSymbol == '.' && isDigit(rune(l.peekSymbol())) {
+		tokenType = token.FLOAT
+		l.readSymbol()
+		l.readDigits()
+	}
+	if l.currentSymbol == 'e' || l.currentSymbol == 'E' {
+		// only an exponent if digits follow, so `1else` is still `1` and `else`
+		exponent := l.peekSymbol()
+		if exponent == '+' || exponent == '-' {
+			exponent = l.peekSymbolAt(1)
+		}
+		if isDigit(rune(exponent)) {
+			tokenType = token.FLOAT
+			l.readSymbol()
+			if l.currentSymbol == '+' || l.currentSymbol == '-' {
+				l.readSymbol()
+			}
+			l.readDigits()
+		}
+	}
+
+	return tokenType, l.input[position:l.position]
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.currentSymbol) {
 		l.readSymbol()
 	}
-	return l.input[position:l.position]
 }
 
 func isDigit(symbol rune) bool {
@@ -168,19 +300,134 @@ func isDigit(symbol rune) bool {
 }
 
 func (l *Lexer) peekSymbol() byte {
-	if l.readPosition >= len(l.input) {
+	return l.peekSymbolAt(0)
+}
+
+// peekSymbolAt looks offset bytes beyond the next one
+func (l *Lexer) peekSymbolAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	return l.input[l.readPosition+offset]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
+// readComment reads a `//` comment up to the end of its line, or a `/* */` comment, in
+// which other `/* */` comments may be nested. It reports false if the input ends first.
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+	l.readSymbol()
+
+	if l.currentSymbol == '/' {
+		for l.currentSymbol != '\n' && l.currentSymbol != 0 {
+			l.readSymbol()
+		}
+		return l.input[position:l.position], true
+	}
+
+	depth := 1
+	l.readSymbol()
+	for depth > 0 {
+		switch {
+		case l.currentSymbol == 0:
+			return l.input[position:l.position], false
+		case l.currentSymbol == '/' && l.peekSymbol() == '*':
+			depth++
+			l.readSymbol()
+		case l.currentSymbol == '*' && l.peekSymbol() == '/':
+			depth--
+			l.readSymbol()
+		}
 		l.readSymbol()
-		if l.currentSymbol == '"' || l.currentSymbol == 0 {
-			break
+	}
+	return l.input[position:l.position], true
+}
+
+// readString reads a string literal, decoding its escapes, or a raw string quoted with
+// backticks, which has no escapes and may span lines. A literal that is unterminated or
+// has an invalid escape is returned as an ERROR token.
+func (l *Lexer) readString(pos token.Position) token.Token {
+	quote := l.currentSymbol
+	var value strings.Builder
+	var invalid token.Token
+
+	l.readSymbol()
+	for l.currentSymbol != quote {
+		switch {
+		case l.currentSymbol == 0:
+			return token.Token{Type: token.ERROR, Literal: "unterminated string", Pos: pos}
+		case l.currentSymbol == '\\' && quote == '"':
+			escapePos := l.currentPosition()
+			if message := l.readEscape(&value); message != "" && invalid.Type == "" {
+				invalid = token.Token{Type: token.ERROR, Literal: message, Pos: escapePos}
+			}
+		default:
+			// Copy the bytes, so invalid UTF-8 is kept as it is
+			value.WriteString(l.input[l.position:l.readPosition])
+			l.readSymbol()
 		}
 	}
-	return l.input[position:l.position]
+	l.readSymbol()
+
+	if invalid.Type != "" {
+		return invalid
+	}
+	return token.Token{Type: token.STRING, Literal: value.String(), Pos: pos}
+}
+
+// readEscape decodes the escape sequence at the current backslash into value, returning
+// a message if it is invalid. It never reads past the end of the input, which readString
+// reports as an unterminated string.
+func (l *Lexer) readEscape(value *strings.Builder) string {
+	l.readSymbol()
+	switch l.currentSymbol {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '\\', '"':
+		value.WriteRune(l.currentSymbol)
+	case 'u':
+		return l.readUnicodeEscape(value)
+	case 0:
+		return ""
+	default:
+		message := fmt.Sprintf("unknown escape sequence \\%c", l.currentSymbol)
+		l.readSymbol()
+		return message
+	}
+	l.readSymbol()
+	return ""
+}
+
+// readUnicodeEscape decodes the `{1F600}` of a `\u{1F600}` escape
+func (l *Lexer) readUnicodeEscape(value *strings.Builder) string {
+	const malformed = "\\u must be followed by 1 to 6 hex digits in braces, as in \\u{1F600}"
+
+	l.readSymbol()
+	if l.currentSymbol != '{' {
+		return malformed
+	}
+	l.readSymbol()
+	position := l.position
+	for isHexDigit(l.currentSymbol) {
+		l.readSymbol()
+	}
+	digits := l.input[position:l.position]
+	if l.currentSymbol != '}' || len(digits) == 0 || len(digits) > 6 {
+		return malformed
+	}
+	l.readSymbol()
+
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(code)) {
+		return fmt.Sprintf("\\u{%s} is not a valid Unicode code point", digits)
+	}
+	value.WriteRune(rune(code))
+	return ""
+}
+
+func isHexDigit(symbol rune) bool {
+	return isDigit(symbol) || 'a' <= symbol && symbol <= 'f' || 'A' <= symbol && symbol <= 'F'
 }
@@ -94,3 +94,292 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n\tx + \"🌴\";\nfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{"let", 1, 1, 0},
+		{"x", 1, 5, 4},
+		{"=", 1, 7, 6},
+		{"5", 1, 9, 8},
+		{";", 1, 10, 9},
+		{"x", 2, 2, 12},
+		{"+", 2, 4, 14},
+		{"🌴", 2, 6, 16},
+		{";", 2, 9, 22},
+		{"foo", 3, 1, 24},
+		{"", 3, 4, 27},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - offset wrong. expected=%d, got=%d", i, tt.expectedOffset, tok.Pos.Offset)
+		}
+		if tok.Pos.Filename != "test.mk" {
+			t.Errorf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+	}
+}
+
+func TestShebangIsSkipped(t *testing.T) {
+	l := New("#!/usr/bin/env monkey\nlet x = 1;")
+
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("expected the shebang line to be skipped, got=%q (%q)", tok.Type, tok.Literal)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Errorf("wrong position after shebang. got=%d:%d", tok.Pos.Line, tok.Pos.Column)
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	l := New("while for in break continue")
+
+	for _, expected := range []token.TokenType{token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE, token.EOF} {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+}
+
+func TestCompoundAssignmentTokens(t *testing.T) {
+	input := "x += 1; x -= 2; x *= 3; x /= 4; x %= 5; x = x * 2;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"}, {token.PLUS_ASSIGN, "+="}, {token.INT, "1"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.MINUS_ASSIGN, "-="}, {token.INT, "2"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.ASTERISK_ASSIGN, "*="}, {token.INT, "3"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.SLASH_ASSIGN, "/="}, {token.INT, "4"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.MODULUS_ASSIGN, "%="}, {token.INT, "5"}, {token.SEMICOLON, ";"},
+		{token.IDENT, "x"}, {token.ASSIGN, "="}, {token.IDENT, "x"}, {token.ASTERISK, "*"}, {token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestOperatorTokens(t *testing.T) {
+	input := "a % b ** c * d <= e >= f < g > h && i || j & k | l ^ m << n >> o ~p"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"}, {token.MODULUS, "%"}, {token.IDENT, "b"}, {token.DOUBLE_ASTERISK, "**"},
+		{token.IDENT, "c"}, {token.ASTERISK, "*"}, {token.IDENT, "d"}, {token.LT_EQ, "<="},
+		{token.IDENT, "e"}, {token.GT_EQ, ">="}, {token.IDENT, "f"}, {token.LT, "<"},
+		{token.IDENT, "g"}, {token.GT, ">"}, {token.IDENT, "h"}, {token.AND, "&&"},
+		{token.IDENT, "i"}, {token.OR, "||"}, {token.IDENT, "j"}, {token.AMPERSAND, "&"},
+		{token.IDENT, "k"}, {token.PIPE, "|"}, {token.IDENT, "l"}, {token.CARET, "^"},
+		{token.IDENT, "m"}, {token.SHIFT_LEFT, "<<"}, {token.IDENT, "n"}, {token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "o"}, {token.TILDE, "~"}, {token.IDENT, "p"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := "3.14 .5 1e-9 2E+3 1.5e3 10 7. 1else 2.x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "1.5e3"},
+		{token.INT, "10"},
+		{token.INT, "7"},
+		{token.PERIOD, "."},
+		{token.INT, "1"},
+		{token.ELSE, "else"},
+		{token.INT, "2"},
+		{token.PERIOD, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading\nlet x = 1; // trailing\n/* block /* nested */ still */ x / 2 /* end */"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		comment         bool
+	}{
+		{token.COMMENT, "// leading", true},
+		{token.LET, "let", false},
+		{token.IDENT, "x", false},
+		{token.ASSIGN, "=", false},
+		{token.INT, "1", false},
+		{token.SEMICOLON, ";", false},
+		{token.COMMENT, "// trailing", true},
+		{token.COMMENT, "/* block /* nested */ still */", true},
+		{token.IDENT, "x", false},
+		{token.SLASH, "/", false},
+		{token.INT, "2", false},
+		{token.COMMENT, "/* end */", true},
+		{token.EOF, "", false},
+	}
+
+	skipping := New(input)
+	emitting := New(input)
+	emitting.EmitComments()
+
+	for i, tt := range tests {
+		tok := emitting.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tt.comment {
+			continue
+		}
+		tok = skipping.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q when skipping comments, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	l := New("/* two\nlines */ x")
+	l.EmitComments()
+
+	comment, x := l.NextToken(), l.NextToken()
+	if comment.Pos.String() != "1:1" || x.Pos.String() != "2:10" {
+		t.Errorf("wrong positions. got=%s and %s", comment.Pos, x.Pos)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x /* never /* closed */")
+	l.NextToken()
+
+	tok := l.NextToken()
+	if tok.Type != token.ERROR || tok.Literal != "unterminated comment" || tok.Pos.Column != 3 {
+		t.Errorf("expected an error token at 1:3, got=%q %q at %s", tok.Type, tok.Literal, tok.Pos)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF, got=%q", tok.Type)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb\r"`, "a\tb\r"},
+		{`"back\\slash"`, `back\slash`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\u{1F600}"`, "😀"},
+		{`"\u{e9}t\u{E9}"`, "été"},
+		{"`raw \\n \"quotes\"`", `raw \n "quotes"`},
+		{"`two\nlines`", "two\nlines"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.STRING || tok.Literal != tt.expected {
+			t.Errorf("%s: expected STRING %q, got=%q %q", tt.input, tt.expected, tok.Type, tok.Literal)
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%s: expected EOF, got=%q %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		message  string
+		column   int
+		nextType token.TokenType
+	}{
+		{`x "never closed`, "unterminated string", 3, token.EOF},
+		{`x "ends in an escape \"`, "unterminated string", 3, token.EOF},
+		{"x `raw\nnever closed", "unterminated string", 3, token.EOF},
+		{`x "a\qb";`, `unknown escape sequence \q`, 5, token.SEMICOLON},
+		{`x "\u{110000}";`, `\u{110000} is not a valid Unicode code point`, 4, token.SEMICOLON},
+		{`x "\uD800";`, `\u must be followed by 1 to 6 hex digits in braces, as in \u{1F600}`, 4, token.SEMICOLON},
+		{`x "\u{12";`, `\u must be followed by 1 to 6 hex digits in braces, as in \u{1F600}`, 4, token.SEMICOLON},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.NextToken()
+
+		tok := l.NextToken()
+		if tok.Type != token.ERROR || tok.Literal != tt.message || tok.Pos.Column != tt.column {
+			t.Errorf("%s: expected error %q at column %d, got=%q %q at %s",
+				tt.input, tt.message, tt.column, tok.Type, tok.Literal, tok.Pos)
+		}
+		if tok := l.NextToken(); tok.Type != tt.nextType {
+			t.Errorf("%s: expected %q after the error, got=%q", tt.input, tt.nextType, tok.Type)
+		}
+	}
+}
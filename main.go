@@ -1,18 +1,173 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
 	"interpreter/repl"
+	"interpreter/vm"
+	"io"
 	"os"
 	"os/user"
 )
 
+const usage = `Usage:
+  monkey [flags]                      start the interactive REPL, or run stdin when it is not a terminal
+  monkey [flags] script.mk [args...]  run a script
+  monkey [flags] - [args...]          run a script read from stdin
+  monkey [flags] -e program [args...] run a program given on the command line and print its value
+
+Arguments after the script are available to it as the array ` + "`args`" + `.
+
+Flags:
+`
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is the whole command line program; it returns the process exit status
+func run(arguments []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	engine := flags.String("engine", string(repl.ENGINE_EVAL), "execution engine: eval (tree-walking) or vm (bytecode)")
+	program := flags.String("e", "", "run `program` and print its value")
+
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+	if *engine != string(repl.ENGINE_EVAL) && *engine != string(repl.ENGINE_VM) {
+		fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+		return 2
+	}
+
+	scriptArgs := flags.Args()
+	isSet := func(name string) bool {
+		set := false
+		flags.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+		return set
+	}
+
+	switch {
+	case isSet("e"):
+		return execute("-e", *program, scriptArgs, repl.Engine(*engine), stdin, stdout, stderr, true)
+	case len(scriptArgs) == 0 && isTerminal(stdin):
+		startREPL(stdin, stdout, repl.Engine(*engine))
+		return 0
+	case len(scriptArgs) == 0 || scriptArgs[0] == "-":
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read stdin: %s\n", err)
+			return 1
+		}
+		if len(scriptArgs) > 0 {
+			scriptArgs = scriptArgs[1:]
+		}
+		return execute("<stdin>", string(source), scriptArgs, repl.Engine(*engine), stdin, stdout, stderr, false)
+	default:
+		source, err := os.ReadFile(scriptArgs[0])
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read script: %s\n", err)
+			return 1
+		}
+		return execute(scriptArgs[0], string(source), scriptArgs[1:], repl.Engine(*engine), stdin, stdout, stderr, false)
+	}
+}
+
+func startREPL(in io.Reader, out io.Writer, engine repl.Engine) {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	fmt.Fprintf(out, "Hello %s! This is the Monkey programming language!\n", user.Username)
+	fmt.Fprintf(out, "Feel free to type in commands\n")
+	repl.StartWithEngine(in, out, engine)
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// execute runs a whole program, reporting errors with their position on stderr. The
+// program's value is only printed when printResult is set, as for `-e`.
+func execute(
+	filename, source string,
+	scriptArgs []string,
+	engine repl.Engine,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+	printResult bool,
+) int {
+	p := parser.New(lexer.NewFile(filename, source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.ParseErrors() {
+			fmt.Fprintln(stderr, err.Error())
+			printExcerpt(stderr, err.Pos.Excerpt(source))
+		}
+		return 1
+	}
+
+	args := &object.Array{Elements: []object.Object{}}
+	for _, arg := range scriptArgs {
+		args.Elements = append(args.Elements, &object.String{Value: arg})
+	}
+
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Stdin = stdin
+	interpreter.Stdout = stdout
+	interpreter.Stderr = stderr
+
+	var result object.Object
+	if engine == repl.ENGINE_VM {
+		symbolTable := compiler.NewSymbolTableFor(interpreter)
+		globals := make([]object.Object, vm.GlobalsSize)
+		globals[symbolTable.Define("args").Index] = args
+
+		comp := compiler.NewWithState(symbolTable, []object.Object{})
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(stderr, "compilation failed: %s\n", err)
+			return 1
+		}
+		machine := vm.NewWithInterpreter(comp.Bytecode(), globals, interpreter)
+		if err := machine.Run(); err != nil {
+			fmt.Fprintf(stderr, "executing bytecode failed: %s\n", err)
+			return 1
+		}
+		result = machine.Result()
+	} else {
+		env := object.NewEnvironment()
+		env.Set("args", args)
+		result = interpreter.Eval(program, env)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, err.Inspect())
+		printExcerpt(stderr, err.Pos.Excerpt(source))
+		printExcerpt(stderr, err.Traceback())
+		return 1
+	}
+	if printResult && result != nil && result != evaluator.NULL {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+	return 0
+}
+
+func printExcerpt(out io.Writer, excerpt string) {
+	if excerpt != "" {
+		fmt.Fprintln(out, excerpt)
+	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRun(t *testing.T, stdin string, arguments ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	status := run(arguments, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestRunExpression(t *testing.T) {
+	for _, engine := range []string{"eval", "vm"} {
+		status, stdout, stderr := testRun(t, "", "-engine", engine, "-e", "len(args) * 10 + 1", "a", "b")
+		if status != 0 {
+			t.Fatalf("%s: expected status 0, got=%d (stderr=%q)", engine, status, stderr)
+		}
+		if stdout != "21\n" {
+			t.Errorf("%s: wrong output. got=%q", engine, stdout)
+		}
+	}
+}
+
+func TestRunScriptFile(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.mk")
+	source := "#!/usr/bin/env monkey\nlet first = args[0];\nfirst + 1;\n"
+	if err := os.WriteFile(script, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, engine := range []string{"eval", "vm"} {
+		status, stdout, stderr := testRun(t, "", "-engine", engine, script, "x")
+		if status != 1 {
+			t.Fatalf("%s: expected status 1, got=%d", engine, status)
+		}
+		if stdout != "" {
+			t.Errorf("%s: scripts should not print their value. got=%q", engine, stdout)
+		}
+		expected := "ERROR: " + script + ":3:7: type mismatch: STRING + INTEGER\nfirst + 1;\n      ^\n"
+		if stderr != expected {
+			t.Errorf("%s: wrong error output.\nexpected=%q\ngot=%q", engine, expected, stderr)
+		}
+	}
+}
+
+func TestRunFromStdin(t *testing.T) {
+	status, _, stderr := testRun(t, "let x = 1;\nx;", "-")
+	if status != 0 {
+		t.Errorf("expected status 0, got=%d (stderr=%q)", status, stderr)
+	}
+
+	status, _, stderr = testRun(t, "let = 1;")
+	if status != 1 {
+		t.Errorf("expected status 1 for a parse error, got=%d", status)
+	}
+	if !strings.HasPrefix(stderr, "<stdin>:1:5: expected next token to be IDENT") {
+		t.Errorf("wrong parse error output. got=%q", stderr)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	if status, _, _ := testRun(t, "", "-engine", "jit", "-e", "1"); status != 2 {
+		t.Errorf("expected status 2 for an unknown engine, got=%d", status)
+	}
+	if status, _, _ := testRun(t, "", "-bogus"); status != 2 {
+		t.Errorf("expected status 2 for an unknown flag, got=%d", status)
+	}
+	if status, _, stderr := testRun(t, "", "does-not-exist.mk"); status != 1 || stderr == "" {
+		t.Errorf("expected status 1 and a message for a missing script, got=%d (%q)", status, stderr)
+	}
+}
+
+func TestRunPrintsTraceback(t *testing.T) {
+	source := "let f = fn(n) {\n  if (n == 0) { 1 / n } else { f(n - 1) }\n};\nf(3);\n"
+
+	for _, engine := range []string{"eval", "vm"} {
+		status, _, stderr := testRun(t, source, "-engine", engine, "-")
+		if status != 1 {
+			t.Fatalf("%s: expected status 1, got=%d", engine, status)
+		}
+		expected := "ERROR: <stdin>:2:19: division by zero\n" +
+			"  if (n == 0) { 1 / n } else { f(n - 1) }\n" +
+			"                  ^\n" +
+			"in f, called at <stdin>:2:33\n" +
+			"... repeated 2 more times\n" +
+			"in f, called at <stdin>:4:2\n"
+		if stderr != expected {
+			t.Errorf("%s: wrong error output.\nexpected=%q\ngot=%q", engine, expected, stderr)
+		}
+	}
+}
+
+func TestRunUsesStreams(t *testing.T) {
+	program := `let name = input("name? "); print("hello " + name); eprint("done"); readline()`
+
+	for _, engine := range []string{"eval", "vm"} {
+		status, stdout, stderr := testRun(t, "monkey\nsecond line\n", "-engine", engine, "-e", program)
+		if status != 0 {
+			t.Fatalf("%s: expected status 0, got=%d (stderr=%q)", engine, status, stderr)
+		}
+		if stdout != "name? hello monkey\nsecond line\n" {
+			t.Errorf("%s: wrong output. got=%q", engine, stdout)
+		}
+		if stderr != "done\n" {
+			t.Errorf("%s: wrong error output. got=%q", engine, stderr)
+		}
+	}
+}
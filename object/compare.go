@@ -0,0 +1,142 @@
+package object
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Equal reports whether a and b have the same value: numbers are compared by value whatever
+// their type, strings, arrays and hashes by their contents, and other objects, such as
+// functions, by identity
+func Equal(a, b Object) bool {
+	return comparison{}.equal(a, b)
+}
+
+// Compare orders a and b, returning -1, 0 or 1: numbers by value, and strings and arrays
+// lexicographically. Any other objects, or objects of different kinds, cannot be ordered.
+func Compare(a, b Object) (int, error) {
+	return comparison{}.compare(a, b)
+}
+
+// comparison remembers the arrays and hashes it is comparing, so one that contains itself
+// is compared without recursing forever
+type comparison map[[2]Object]bool
+
+func (c comparison) equal(a, b Object) bool {
+	if isNumber(a) && isNumber(b) {
+		if a.Type() == INTEGER_OBJ && b.Type() == INTEGER_OBJ {
+			return CompareIntegers(a, b) == 0
+		}
+		return floatValue(a) == floatValue(b)
+	}
+	if a == b {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *Null:
+		return true
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if c.visit(a, b) {
+			return true
+		}
+		for i := range a.Elements {
+			if !c.equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b := b.(*Hash)
+		if len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		if c.visit(a, b) {
+			return true
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !c.equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (c comparison) compare(a, b Object) (int, error) {
+	if isNumber(a) && isNumber(b) {
+		return compareNumbers(a, b)
+	}
+	if a.Type() != b.Type() {
+		return 0, fmt.Errorf("cannot order %s and %s", a.Type(), b.Type())
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return strings.Compare(a.Value, b.(*String).Value), nil
+	case *Array:
+		b := b.(*Array)
+		if c.visit(a, b) {
+			return 0, nil
+		}
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			order, err := c.compare(a.Elements[i], b.Elements[i])
+			if err != nil || order != 0 {
+				return order, err
+			}
+		}
+		return cmp.Compare(len(a.Elements), len(b.Elements)), nil
+	}
+	return 0, fmt.Errorf("cannot order %s values", a.Type())
+}
+
+// visit records that a and b are being compared, reporting whether they already were
+func (c comparison) visit(a, b Object) bool {
+	pair := [2]Object{a, b}
+	if c[pair] {
+		return true
+	}
+	c[pair] = true
+	return false
+}
+
+func isNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// compareNumbers orders two numbers, promoting an integer compared with a float to a
+// float, as arithmetic does. NaN is ordered before every other number, so sorting puts it
+// first.
+func compareNumbers(a, b Object) (int, error) {
+	if a.Type() == INTEGER_OBJ && b.Type() == INTEGER_OBJ {
+		return CompareIntegers(a, b), nil
+	}
+	return cmp.Compare(floatValue(a), floatValue(b)), nil
+}
+
+func floatValue(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Float:
+		return obj.Value
+	case *Integer:
+		return float64(obj.Value)
+	}
+	value, _ := BigValue(obj)
+	float, _ := new(big.Float).SetInt(value).Float64()
+	return float
+}
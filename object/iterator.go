@@ -0,0 +1,78 @@
+package object
+
+import (
+	"slices"
+	"strings"
+)
+
+// Iterator walks what a `for` loop visits: array elements and string runes with their
+// index, and hash values with their key. Hashes are walked in key order, so loops over
+// them are repeatable.
+type Iterator struct {
+	next func() (key, value Object, ok bool)
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Next returns the next key and value, or ok == false once the collection is exhausted
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// NewIterator returns an iterator over collection, or false if it can't be iterated
+func NewIterator(collection Object) (*Iterator, bool) {
+	index := 0
+
+	switch collection := collection.(type) {
+	case *Array:
+		return &Iterator{next: func() (Object, Object, bool) {
+			if index >= len(collection.Elements) {
+				return nil, nil, false
+			}
+			index++
+			return &Integer{Value: int64(index - 1)}, collection.Elements[index-1], true
+		}}, true
+	case *String:
+		runes := []rune(collection.Value)
+		return &Iterator{next: func() (Object, Object, bool) {
+			if index >= len(runes) {
+				return nil, nil, false
+			}
+			index++
+			return &Integer{Value: int64(index - 1)}, &String{Value: string(runes[index-1])}, true
+		}}, true
+	case *Hash:
+		pairs := collection.SortedPairs()
+		return &Iterator{next: func() (Object, Object, bool) {
+			if index >= len(pairs) {
+				return nil, nil, false
+			}
+			index++
+			return pairs[index-1].Key, pairs[index-1].Value, true
+		}}, true
+	default:
+		return nil, false
+	}
+}
+
+// SortedPairs returns the pairs ordered by key: grouped by key type, then ordered by
+// Compare where it can, and otherwise by their Inspect strings
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	slices.SortFunc(pairs, func(a, b HashPair) int {
+		if a.Key.Type() != b.Key.Type() {
+			return strings.Compare(string(a.Key.Type()), string(b.Key.Type()))
+		}
+		if order, err := Compare(a.Key, b.Key); err == nil {
+			return order
+		}
+		return strings.Compare(a.Key.Inspect(), b.Key.Inspect())
+	})
+
+	return pairs
+}
@@ -2,9 +2,15 @@ package object
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"hash/fnv"
 	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/token"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -17,6 +23,7 @@ type Object interface {
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -26,6 +33,12 @@ const (
 	BUILT_IN_OBJ     = "BUILT_IN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	ITERATOR_OBJ     = "ITERATOR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 type HashKey struct {
@@ -41,6 +54,81 @@ func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: uint64(i.Value)} }
 
+// BigInt is an integer too large for an int64. It reports INTEGER_OBJ, so scripts see
+// small and big integers as one type; arithmetic promotes to a BigInt on overflow and
+// demotes back to an Integer once the result fits, see IntegerFromBig.
+type BigInt struct {
+	Value *big.Int // shared, never modified in place
+}
+
+// The hash key type of big integers, whose values never collide with an Integer's
+const bigIntHashKeyType ObjectType = "BIG_INT"
+
+func (bi *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (bi *BigInt) Inspect() string  { return bi.Value.String() }
+func (bi *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(bi.Value.Bytes())
+	return HashKey{Type: bigIntHashKeyType, Value: h.Sum64() ^ uint64(bi.Value.Sign())}
+}
+
+// IntegerFromBig returns an Integer if value fits in an int64, or a BigInt otherwise, so
+// that every integer has a single representation
+func IntegerFromBig(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+// BigValue returns the value of an Integer or BigInt as a big.Int, which must not be
+// modified
+func BigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+// CompareIntegers orders two Integers or BigInts, returning -1, 0 or 1
+func CompareIntegers(a, b Object) int {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return cmp.Compare(a.Value, b.Value)
+		}
+	}
+	aValue, _ := BigValue(a)
+	bValue, _ := BigValue(b)
+	return aValue.Cmp(bValue)
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always shows a float as one, e.g. `2.0` rather than `2`
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// HashKey gives a whole float the key of the equal integer, since 2 == 2.0
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		whole, _ := big.NewFloat(f.Value).Int(nil)
+		return IntegerFromBig(whole).(Hashable).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type BooleanType string
 
 type Boolean struct {
@@ -71,14 +159,95 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue unwind a loop body up to the loop, like ReturnValue does for functions
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// The kinds of error the interpreter raises itself. A script can throw errors of any kind,
+// and those it throws without one are ERROR_KIND.
+const (
+	RUNTIME_ERROR_KIND  = "RuntimeError"
+	INTERNAL_ERROR_KIND = "InternalError" // a bug in the interpreter rather than the script
+	ERROR_KIND          = "Error"
+
+	// An evaluation exceeded one of its limits; see evaluator.Limits
+	STEP_LIMIT_KIND       = "StepLimitExceeded"
+	CALL_DEPTH_LIMIT_KIND = "CallDepthExceeded"
+	MEMORY_LIMIT_KIND     = "MemoryLimitExceeded"
+	TIMEOUT_KIND          = "Timeout"
+
+	// The context an evaluation was run with was cancelled; see evaluator.EvalContext
+	CANCELLED_KIND = "Cancelled"
+)
+
 type Error struct {
 	Message string
+	Kind    string
+	Pos     token.Position // where the error was raised, if known
+	Stack   []StackFrame   // the calls the error unwound through, innermost first
+}
+
+// StackFrame is a function call that an error unwound through
+type StackFrame struct {
+	Function string         // empty for an anonymous function
+	CallPos  token.Position // invalid if a built-in made the call
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if !e.Pos.IsValid() {
+		return "ERROR: " + e.Message
+	}
+	return "ERROR: " + e.Pos.String() + ": " + e.Message
+}
+
+// Error lets Go code embedding the interpreter return the error as a Go error
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Traceback describes the error's stack, one call per line, with a run of identical calls,
+// as recursion makes, collapsed into one
+func (e *Error) Traceback() string {
+	var lines []string
+
+	for i := 0; i < len(e.Stack); {
+		frame := e.Stack[i]
+		repeats := 0
+		for i+repeats+1 < len(e.Stack) && e.Stack[i+repeats+1] == frame {
+			repeats++
+		}
+		i += repeats + 1
+
+		name := frame.Function
+		if name == "" {
+			name = "<anonymous>"
+		}
+		if frame.CallPos.IsValid() {
+			lines = append(lines, fmt.Sprintf("in %s, called at %s", name, frame.CallPos))
+		} else {
+			lines = append(lines, fmt.Sprintf("in %s, called by a built-in", name))
+		}
+		if repeats > 0 {
+			lines = append(lines, fmt.Sprintf("... repeated %d more times", repeats))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
 
 type Function struct {
+	Name       string // the name it was bound to by `let`, if any
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -86,10 +255,15 @@ type Function struct {
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Body)
+}
+
+// inspectFunction writes out the source of a function, as both engines print it
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 
@@ -97,7 +271,7 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -117,8 +291,14 @@ func (s *String) HashKey() HashKey {
 
 type BuiltInFunction func(args ...Object) Object
 
+// A Caller calls the function fn with args, returning its value or the error it raised
+type Caller func(fn Object, args []Object) Object
+
 type BuiltIn struct {
 	Fn BuiltInFunction
+	// CallbackFn, if set, is called instead of Fn by the engine running a program, with a
+	// Caller that runs the functions the built-in is given on that engine, under its limits
+	CallbackFn func(call Caller, args ...Object) Object
 }
 
 func (b *BuiltIn) Type() ObjectType { return BUILT_IN_OBJ }
@@ -172,3 +352,45 @@ func (h *Hash) Inspect() string {
 type Hashable interface {
 	HashKey() HashKey
 }
+
+// A function body lowered to bytecode by the compiler; it only lives in the constant pool
+type CompiledFunction struct {
+	Name          string // as for Function
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	LocalNames    []string               // indexed like the local slots, for error messages
+	FreeNames     []string               // indexed like the closure's free variables
+	Positions     map[int]token.Position // source position of each instruction, by offset
+	Literal       *ast.FunctionLiteral   // the source it was compiled from; nil for a program
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// The VM's runtime function value. It reports FUNCTION_OBJ so scripts see the same
+// type whichever engine runs them.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	if c.Fn.Literal == nil {
+		return fmt.Sprintf("Closure[%p]", c)
+	}
+	return inspectFunction(c.Fn.Literal.Parameters, c.Fn.Literal.Body)
+}
+
+// Cell holds a local variable once a closure captures it. The function's slot and the
+// closure both refer to the cell, so an assignment in one is seen by the other, as with
+// a shared Environment in the evaluator.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return c.Value.Inspect() }
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"interpreter/token"
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	sameString1 := &String{Value: "Hello World"}
@@ -14,3 +19,108 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have different hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("a whole float has a different hash key from the equal integer")
+	}
+	if (&Float{Value: 2.5}).HashKey() != (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with the same value have different hash keys")
+	}
+	if (&Float{Value: 2.5}).HashKey() == (&Float{Value: 3.5}).HashKey() {
+		t.Errorf("floats with different values have the same hash key")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect() for %g. expected=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestIntegerFromBig(t *testing.T) {
+	if _, ok := IntegerFromBig(big.NewInt(42)).(*Integer); !ok {
+		t.Errorf("a big.Int that fits in an int64 should be an Integer")
+	}
+
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	bigInt, ok := IntegerFromBig(huge).(*BigInt)
+	if !ok {
+		t.Fatalf("a big.Int beyond int64 should be a BigInt")
+	}
+	if bigInt.Type() != INTEGER_OBJ {
+		t.Errorf("a BigInt should report INTEGER, got=%s", bigInt.Type())
+	}
+	if bigInt.HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("a BigInt has the hash key of an Integer")
+	}
+	if bigInt.HashKey() != (&Float{Value: 1e20}).HashKey() {
+		t.Errorf("a whole float has a different hash key from the equal BigInt")
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	call := func(line int) token.Position { return token.Position{Line: line, Column: 1} }
+
+	err := &Error{Message: "boom", Stack: []StackFrame{
+		{Function: "", CallPos: token.Position{}},
+		{Function: "walk", CallPos: call(2)},
+		{Function: "walk", CallPos: call(2)},
+		{Function: "walk", CallPos: call(2)},
+		{Function: "walk", CallPos: call(5)},
+	}}
+
+	expected := "in <anonymous>, called by a built-in\n" +
+		"in walk, called at 2:1\n" +
+		"... repeated 2 more times\n" +
+		"in walk, called at 5:1"
+	if err.Traceback() != expected {
+		t.Errorf("wrong traceback.\nexpected=%q\ngot=%q", expected, err.Traceback())
+	}
+
+	if (&Error{Message: "boom"}).Traceback() != "" {
+		t.Errorf("an error raised outside any function should have no traceback")
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	nan := &Float{Value: math.NaN()}
+	big := &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+	tests := []struct {
+		a, b     Object
+		expected int
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1},
+		{&Integer{Value: 2}, &Float{Value: 1.5}, 1},
+		{&Float{Value: 2}, &Integer{Value: 2}, 0},
+		{big, &Integer{Value: math.MaxInt64}, 1},
+		{big, &Float{Value: 1e30}, -1},
+		{nan, &Float{Value: math.Inf(-1)}, -1},
+		{nan, nan, 0},
+	}
+
+	for _, tt := range tests {
+		order, err := Compare(tt.a, tt.b)
+		if err != nil || order != tt.expected {
+			t.Errorf("Compare(%s, %s): expected %d, got=%d, %v", tt.a.Inspect(), tt.b.Inspect(), tt.expected, order, err)
+		}
+	}
+
+	if Equal(nan, nan) {
+		t.Errorf("NaN is equal to itself")
+	}
+}
@@ -1,66 +1,102 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
 	"interpreter/token"
+	"math/big"
 	"strconv"
 )
 
+// Precedences, from the loosest binding to the tightest. As in Python, the bitwise
+// operators bind tighter than comparisons, so `x & 1 == 0` tests the lowest bit.
 const (
 	_int = iota
 	LOWEST
+	ASSIGN
+	OR
+	AND
 	EQUALS
 	LESSGREATER
+	BITWISE_OR
+	BITWISE_XOR
+	BITWISE_AND
+	SHIFT
 	SUM
 	PRODUCT
 	PREFIX
+	POWER // tighter than a prefix operator on its left, so `-2 ** 2` is -4
 	CALL
 	INDEX
 )
 
 var operatorPrecedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.MODULUS:  PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PIPE:            BITWISE_OR,
+	token.CARET:           BITWISE_XOR,
+	token.AMPERSAND:       BITWISE_AND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.MODULUS:         PRODUCT,
+	token.DOUBLE_ASTERISK: POWER,
+	token.LPAREN:          CALL,
+	token.PERIOD:          CALL,
+	token.LBRACKET:        INDEX,
+
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.MODULUS_ASSIGN:  ASSIGN,
 }
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []*ParseError
 
 	curToken  token.Token
 	peekToken token.Token
 
+	loopDepth int // how many loops enclose the current token, to validate break and continue
+
 	prefixParserFunctions map[token.TokenType]prefixParseFunction
 	infixParserFunctions  map[token.TokenType]infixParseFunction
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*ParseError{}}
 
 	p.prefixParserFunctions = make(map[token.TokenType]prefixParseFunction)
 	p.registerPrefixFunction(token.IDENT, p.parseIdentifier)
 	p.registerPrefixFunction(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixFunction(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixFunction(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixFunction(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixFunction(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefixFunction(token.TRUE, p.parseBoolean)
 	p.registerPrefixFunction(token.FALSE, p.parseBoolean)
 	p.registerPrefixFunction(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefixFunction(token.IF, p.parseIfExpression)
+	p.registerPrefixFunction(token.TRY, p.parseTryExpression)
 	p.registerPrefixFunction(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixFunction(token.STRING, p.parseStringLiteral)
 	p.registerPrefixFunction(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixFunction(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefixFunction(token.ERROR, p.parseErrorToken)
 
 	p.infixParserFunctions = make(map[token.TokenType]infixParseFunction)
 
@@ -69,6 +105,12 @@ func New(l *lexer.Lexer) *Parser {
 	}
 	p.registerInfixFunction(token.LPAREN, p.parseCallExpression)
 	p.registerInfixFunction(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixFunction(token.PERIOD, p.parsePeriodExpression)
+	for operator, precedence := range operatorPrecedences {
+		if precedence == ASSIGN {
+			p.registerInfixFunction(operator, p.parseAssignExpression)
+		}
+	}
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -101,22 +143,72 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 	precedence := p.curPrecedence()
+	if precedence == POWER {
+		// Exponentiation is right-associative, so `2 ** 3 ** 2` is `2 ** (3 ** 2)`
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		// the target already failed to parse
+	default:
+		p.addError(p.curToken.Pos, "cannot assign to %s", target.String())
+	}
+
+	p.nextToken()
+	// Assignment is right-associative, so `a = b = 1` assigns 1 to both
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
 func (p *Parser) registerInfixFunction(tokenType token.TokenType, function infixParseFunction) {
 	p.infixParserFunctions[tokenType] = function
 }
 
+type ParseError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Errors returns each error as "file:line:col: message"
 func (p *Parser) Errors() []string {
+	messages := make([]string, 0, len(p.errors))
+	for _, err := range p.errors {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+// ParseErrors returns the errors with their positions, e.g. to quote the source they point at
+func (p *Parser) ParseErrors() []*ParseError {
 	return p.errors
 }
 
+func (p *Parser) addError(pos token.Position, format string, a ...interface{}) {
+	p.errors = append(p.errors, &ParseError{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	message := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, message)
+	p.addError(p.peekToken.Pos, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -136,6 +228,13 @@ func (p *Parser) curPrecedence() int {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	// in case the lexer was told to keep comments
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+	if p.peekToken.Type == token.ERROR {
+		p.addError(p.peekToken.Pos, "%s", p.peekToken.Literal)
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -162,6 +261,16 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -204,6 +313,126 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// with two variables, the first is the key and the second the value
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Collection = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.addError(p.curToken.Pos, "break outside of a loop")
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.addError(p.curToken.Pos, "continue outside of a loop")
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -217,8 +446,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFunctionError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function found for %s", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, "no prefix parse function found for %s", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -241,13 +469,37 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExpression
 }
 
+// parseErrorToken stands in for a malformed literal, which nextToken already reported
+func (p *Parser) parseErrorToken() ast.Expression {
+	return nil
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if big, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			literal.Big = big
+			return literal
+		}
+	}
+	if err != nil {
+		p.addError(p.curToken.Pos, "Could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		message := fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, message)
+		p.addError(p.curToken.Pos, "Could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -305,6 +557,50 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		// the caught error need not be named
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.addError(expression.Token.Pos, "try without catch or finally")
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -325,6 +621,11 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	funcLiteral := &ast.FunctionLiteral{Token: p.curToken}
 
+	// a function body is not inside the loops around the function
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = outerLoopDepth }()
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -376,16 +677,64 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseIndexExpression parses `left[index]`, or a slice `left[start:end:step]`
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	bracket := p.curToken
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+
+	var start ast.Expression
+	if !p.curTokenIs(token.COLON) {
+		start = p.parseExpression(LOWEST)
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: bracket, Left: left, Index: start}
+		}
+		p.nextToken()
+	}
+
+	exp := &ast.SliceExpression{Token: bracket, Left: left, Start: start}
+	exp.End = p.parseSliceBound()
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Step = p.parseSliceBound()
+	}
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 	return exp
 }
 
+// parseSliceBound parses the bound of a slice following a colon, or returns nil if it is
+// left out
+func (p *Parser) parseSliceBound() ast.Expression {
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
+// parsePeriodExpression parses `receiver.name(args)` as a method call, and `hash.key` as
+// sugar for `hash["key"]`
+func (p *Parser) parsePeriodExpression(left ast.Expression) ast.Expression {
+	period := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		key := &ast.StringLiteral{Token: p.curToken, Value: name.Value}
+		return &ast.IndexExpression{Token: period, Left: left, Index: key}
+	}
+	p.nextToken()
+	exp := &ast.MethodCallExpression{Token: period, Receiver: left, Method: name}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	return exp
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
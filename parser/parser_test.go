@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
+	"slices"
 	"testing"
 )
 
@@ -168,6 +169,48 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	p := New(lexer.New("100000000000000000000;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("Expression is not *ast.IntegerLiteral: got %T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "100000000000000000000" {
+		t.Errorf("Literal has the wrong big value, got %v", literal.Big)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5;", 0.5},
+		{"1e-9;", 1e-9},
+		{"2E+3;", 2000},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("Expression is not *ast.FloatLiteral: got %T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("Literal has the wrong value. Expected %g, got %g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestTrueBooleanExpression(t *testing.T) {
 	input := "true;"
 
@@ -240,6 +283,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-15;", "-", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5;", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -304,6 +348,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
@@ -453,6 +507,70 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1]);",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a % b * c;",
+			"((a % b) * c)",
+		},
+		{
+			"2 ** 3 ** 2;",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2;",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** -1 * 3;",
+			"((2 ** (-1)) * 3)",
+		},
+		{
+			"a ** b[1];",
+			"(a ** (b[1]))",
+		},
+		{
+			"a <= b == c >= d;",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c || d;",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a < b && c != d || !e;",
+			"(((a < b) && (c != d)) || (!e))",
+		},
+		{
+			"a | b ^ c & d;",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & 1 == 0;",
+			"((a & 1) == 0)",
+		},
+		{
+			"1 << a + b >> 2;",
+			"((1 << (a + b)) >> 2)",
+		},
+		{
+			"~a & b;",
+			"((~a) & b)",
+		},
+		{
+			"a.b(c).d(1 + 2)[0];",
+			"(a.b(c).d((1 + 2))[0])",
+		},
+		{
+			"-a.abs() * 2;",
+			"((-a.abs()) * 2)",
+		},
+		{
+			"h.key + 1;",
+			"((h[key]) + 1)",
+		},
+		{
+			"x = a || b;",
+			"(x = (a || b))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -876,6 +994,38 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs[1:2];", "(xs[1:2])"},
+		{"xs[:2];", "(xs[:2])"},
+		{"xs[1:];", "(xs[1:])"},
+		{"xs[:];", "(xs[:])"},
+		{"xs[::2];", "(xs[::2])"},
+		{"xs[1::];", "(xs[1:])"},
+		{"xs[a + 1:-b:c * 2];", "(xs[(a + 1):(-b):(c * 2)])"},
+		{"a * xs[1:][0];", "(a * ((xs[1:])[0]))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New("xs[1:2:3:4];"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) == 0 || errors[0] != "1:9: expected next token to be ], got : instead" {
+		t.Errorf("expected an error for a fourth bound, got=%q", errors)
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3};`
 
@@ -1000,3 +1150,374 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		testBooleanLiteraal(t, value, expectedValue)
 	}
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedMessages []string
+	}{
+		{"let = 5;", []string{"test.mk:1:5: expected next token to be IDENT, got = instead"}},
+		{"let x = 5;\nlet y 6;", []string{"test.mk:2:7: expected next token to be =, got INT instead"}},
+		{"let x = 1 +;", []string{"test.mk:1:12: no prefix parse function found for ;"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("test.mk", tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) < len(tt.expectedMessages) {
+			t.Fatalf("%q: expected %d errors, got=%q", tt.input, len(tt.expectedMessages), errors)
+		}
+		for i, expected := range tt.expectedMessages {
+			if errors[i] != expected {
+				t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, expected, errors[i])
+			}
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b;\n};\nadd(1, 2);"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	body := let.Value.(*ast.FunctionLiteral).Body
+	infix := body.Statements[0].(*ast.ExpressionStatement).Expression
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node           ast.Node
+		expectedLine   int
+		expectedColumn int
+	}{
+		{program, 1, 1},
+		{let, 1, 1},
+		{let.Value, 1, 11},
+		{body, 1, 20},
+		{infix, 2, 5},
+		{call, 4, 4},
+	}
+
+	for _, tt := range tests {
+		pos := tt.node.Pos()
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedColumn {
+			t.Errorf("%s: wrong position. expected=%d:%d, got=%d:%d",
+				tt.node.String(), tt.expectedLine, tt.expectedColumn, pos.Line, pos.Column)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := "while (x < 10) { x; break; continue; };"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement, got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.WhileStatement, got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body does not contain 3 statements, got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not *ast.BreakStatement, got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not *ast.ContinueStatement, got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"for (x in xs) { x; }", "", "x", "for (x in xs) x"},
+		{"for (i, x in [1, 2]) { i; }", "i", "x", "for (i, x in [1, 2]) i"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("statement is not *ast.ForStatement, got=%T", program.Statements[0])
+		}
+		if tt.expectedKey == "" && stmt.Key != nil {
+			t.Errorf("expected no key variable, got=%s", stmt.Key)
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong String(). expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestBreakAndContinueOutsideLoops(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"if (true) { continue; }", "1:13: continue outside of a loop"},
+		{"while (true) { fn() { break; }; }", "1:23: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedMessage {
+			t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expectedMessage, errors)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expected         string
+	}{
+		{"x = 5;", "=", "(x = 5)"},
+		{"x += y * 2;", "+=", "(x += (y * 2))"},
+		{"x -= 1;", "-=", "(x -= 1)"},
+		{"x *= 1;", "*=", "(x *= 1)"},
+		{"x /= 1;", "/=", "(x /= 1)"},
+		{"x %= 1;", "%=", "(x %= 1)"},
+		{"a = b = c;", "=", "(a = (b = c))"},
+		{"xs[i + 1] = 2;", "=", "((xs[(i + 1)]) = 2)"},
+		{`h["k"] += 1;`, "+=", "((h[k]) += 1)"},
+		{"x = a == b;", "=", "(x = (a == b))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("statement is not *ast.ExpressionStatement, got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("expression is not *ast.AssignExpression, got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.expectedOperator {
+			t.Errorf("wrong operator. expected=%q, got=%q", tt.expectedOperator, exp.Operator)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("wrong String(). expected=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 = x;", "1:3: cannot assign to 5"},
+		{"f() = 1;", "1:5: cannot assign to f()"},
+		{"a + b = 1;", "1:7: cannot assign to (a + b)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedMessage {
+			t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expectedMessage, errors)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedParameter string
+		expectCatch       bool
+		expectFinally     bool
+		expected          string
+	}{
+		{"try { x; } catch (e) { e; }", "e", true, false, "try x catch (e) e"},
+		{"try { x; } catch { y; }", "", true, false, "try x catch y"},
+		{"try { x; } finally { y; }", "", false, true, "try x finally y"},
+		{"try { x; } catch (err) { y; } finally { z; }", "err", true, true, "try x catch (err) y finally z"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("statement is not *ast.ExpressionStatement, got=%T", program.Statements[0])
+		}
+		try, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("expression is not *ast.TryExpression, got=%T", stmt.Expression)
+		}
+
+		if tt.expectedParameter == "" {
+			if try.Parameter != nil {
+				t.Errorf("%q: expected no parameter, got=%s", tt.input, try.Parameter)
+			}
+		} else if !testIdentifier(t, try.Parameter, tt.expectedParameter) {
+			return
+		}
+		if (try.Catch != nil) != tt.expectCatch {
+			t.Errorf("%q: expected catch block %t, got=%+v", tt.input, tt.expectCatch, try.Catch)
+		}
+		if (try.Finally != nil) != tt.expectFinally {
+			t.Errorf("%q: expected finally block %t, got=%+v", tt.input, tt.expectFinally, try.Finally)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	p := New(lexer.New(`throw "bad" + x;`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.ThrowStatement, got=%T", program.Statements[0])
+	}
+	if stmt.String() != "throw (bad + x);" {
+		t.Errorf("wrong String, got=%q", stmt.String())
+	}
+}
+
+func TestTryWithoutCatchOrFinally(t *testing.T) {
+	p := New(lexer.New("try { x; }"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:1: try without catch or finally" {
+		t.Errorf("expected a single error, got=%q", errors)
+	}
+}
+
+func TestCommentsAreIgnored(t *testing.T) {
+	input := `
+// a line comment
+let x = 5; // after a statement
+/* a block /* nested */ comment */
+let y = x /* inline */ + 1;
+`
+	for _, emit := range []bool{false, true} {
+		l := lexer.New(input)
+		if emit {
+			l.EmitComments()
+		}
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 2 {
+			t.Fatalf("expected 2 statements, got=%d", len(program.Statements))
+		}
+		if program.String() != "let x = 5;let y = (x + 1);" {
+			t.Errorf("program.String() wrong. got=%q", program.String())
+		}
+	}
+}
+
+func TestMalformedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let s = "never closed`, []string{"1:9: unterminated string"}},
+		{"let s = `never\nclosed", []string{"1:9: unterminated string"}},
+		{`let s = "a\qb"; let t = "\u{110000}";`, []string{
+			`1:11: unknown escape sequence \q`,
+			`1:26: \u{110000} is not a valid Unicode code point`,
+		}},
+		{"1 + /* never closed", []string{"1:5: unterminated comment"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if !slices.Equal(p.Errors(), tt.expected) {
+			t.Errorf("%s: expected errors %q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMethodCallParsing(t *testing.T) {
+	p := New(lexer.New("xs.push(1, 2 * 3);"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MethodCallExpression, got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Receiver, "xs") || !testIdentifier(t, exp.Method, "push") {
+		return
+	}
+	if len(exp.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments, got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+}
+
+func TestPropertyAccessParsing(t *testing.T) {
+	p := New(lexer.New(`h.name = "x";`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	assign, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.AssignExpression, got=%T", stmt.Expression)
+	}
+	index, ok := assign.Target.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("assign.Target is not ast.IndexExpression, got=%T", assign.Target)
+	}
+	testIdentifier(t, index.Left, "h")
+	if key, ok := index.Index.(*ast.StringLiteral); !ok || key.Value != "name" {
+		t.Errorf("index.Index is not the string literal \"name\", got=%T (%s)", index.Index, index.Index)
+	}
+
+	p = New(lexer.New("h.(1);"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) == 0 || errors[0] != "1:3: expected next token to be IDENT, got ( instead" {
+		t.Errorf("expected an error for a missing name, got=%q", errors)
+	}
+}
@@ -0,0 +1,230 @@
+package repl
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// command is a REPL command, typed as a colon, its name and an argument
+type command struct {
+	argument    string // described for :help; empty if the command takes none
+	description string
+	run         func(s *session, argument string)
+}
+
+var commands map[string]command
+
+func init() {
+	// Set in init, since :help refers to commands
+	commands = map[string]command{
+		"help":   {"", "list the commands", (*session).help},
+		"env":    {"", "list the bindings in the environment", (*session).listBindings},
+		"tokens": {"source", "show the tokens the lexer reads from source, comments included", (*session).showTokens},
+		"ast":    {"source", "show the tree the parser builds from source", (*session).showAST},
+		"type":   {"expression", "evaluate expression and show the type of its value", (*session).showType},
+		"time":   {"expression", "evaluate expression and show how long it took", (*session).timeEvaluation},
+		"load":   {"file", "run the Monkey source in file in this session", (*session).load},
+		"save":   {"file", "write the inputs run without errors in this session to file", (*session).save},
+		"reset":  {"", "forget all bindings", (*session).resetCommand},
+	}
+}
+
+// runCommand runs input, a colon followed by a command name and its argument
+func (s *session) runCommand(input string) {
+	name, argument, _ := strings.Cut(strings.TrimPrefix(input, ":"), " ")
+	argument = strings.TrimSpace(argument)
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, see :help\n", name)
+		return
+	}
+	if cmd.argument != "" && argument == "" {
+		fmt.Fprintf(s.out, "usage: :%s <%s>\n", name, cmd.argument)
+		return
+	}
+	cmd.run(s, argument)
+}
+
+func (s *session) help(string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		usage := ":" + name
+		if commands[name].argument != "" {
+			usage += " <" + commands[name].argument + ">"
+		}
+		fmt.Fprintf(s.out, "%-20s %s\n", usage, commands[name].description)
+	}
+}
+
+func (s *session) listBindings(string) {
+	listed := 0
+	if s.engine == ENGINE_VM {
+		for _, symbol := range s.symbolTable.Symbols() {
+			if symbol.Scope == compiler.GlobalScope && s.globals[symbol.Index] != nil {
+				s.writeBinding(symbol.Name, s.globals[symbol.Index].Inspect())
+				listed++
+			}
+		}
+	} else {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			s.writeBinding(name, value.Inspect())
+			listed++
+		}
+	}
+
+	if listed == 0 {
+		io.WriteString(s.out, "no bindings\n")
+	}
+}
+
+// writeBinding lists a binding on one line, even if its value spans several, as functions do
+func (s *session) writeBinding(name, value string) {
+	fmt.Fprintf(s.out, "%s = %s\n", name, strings.ReplaceAll(value, "\n", " "))
+}
+
+func (s *session) showTokens(source string) {
+	l := lexer.New(source)
+	l.EmitComments()
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func (s *session) showAST(source string) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.ParseErrors())
+		return
+	}
+	writeTree(s.out, "", reflect.ValueOf(program), 0)
+}
+
+func (s *session) showType(expression string) {
+	evaluated, ok := s.run("", expression)
+	if !ok {
+		return
+	}
+	if evaluated == nil {
+		io.WriteString(s.out, "no value\n")
+		return
+	}
+	fmt.Fprintln(s.out, evaluated.Type())
+}
+
+func (s *session) timeEvaluation(expression string) {
+	start := time.Now()
+	evaluated, ok := s.run("", expression)
+	elapsed := time.Since(start)
+
+	if ok && evaluated != nil {
+		fmt.Fprintln(s.out, evaluated.Inspect())
+	}
+	fmt.Fprintf(s.out, "took %s\n", elapsed)
+}
+
+func (s *session) load(file string) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(s.out, "could not load %s: %s\n", file, err)
+		return
+	}
+	if _, ok := s.run(file, string(source)); ok {
+		fmt.Fprintf(s.out, "loaded %s\n", file)
+	}
+}
+
+func (s *session) save(file string) {
+	source := strings.Join(s.inputs, "\n")
+	if source != "" {
+		source += "\n"
+	}
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		fmt.Fprintf(s.out, "could not save %s: %s\n", file, err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved %d inputs to %s\n", len(s.inputs), file)
+}
+
+func (s *session) resetCommand(string) {
+	s.reset()
+	io.WriteString(s.out, "environment reset\n")
+}
+
+// writeTree writes an AST node and, indented below it, the nodes it contains. Fields
+// holding plain values, such as an operator, are shown on the node's own line.
+func writeTree(out io.Writer, label string, v reflect.Value, depth int) {
+	if (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) && v.IsNil() {
+		return
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	node := v.Elem()
+
+	line := strings.Repeat("  ", depth)
+	if label != "" {
+		line += label + ": "
+	}
+	line += node.Type().Name()
+
+	for i := 0; i < node.NumField(); i++ {
+		field, value := node.Type().Field(i), node.Field(i)
+		if field.Type == reflect.TypeOf(token.Token{}) {
+			continue
+		}
+		switch value.Kind() {
+		case reflect.String:
+			line += fmt.Sprintf(" %s=%q", field.Name, value.String())
+		case reflect.Int64, reflect.Float64, reflect.Bool:
+			line += fmt.Sprintf(" %s=%v", field.Name, value.Interface())
+		case reflect.Pointer:
+			if big, ok := value.Interface().(*big.Int); ok && big != nil {
+				line += fmt.Sprintf(" %s=%s", field.Name, big)
+			}
+		}
+	}
+	fmt.Fprintln(out, line)
+
+	for i := 0; i < node.NumField(); i++ {
+		field, value := node.Type().Field(i), node.Field(i)
+		switch value.Kind() {
+		case reflect.Interface, reflect.Pointer:
+			if _, ok := value.Interface().(ast.Node); ok {
+				writeTree(out, field.Name, value, depth+1)
+			}
+		case reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				writeTree(out, fmt.Sprintf("%s[%d]", field.Name, j), value.Index(j), depth+1)
+			}
+		case reflect.Map:
+			// Hash literal pairs, in the order they are written
+			keys := value.MapKeys()
+			slices.SortFunc(keys, func(a, b reflect.Value) int {
+				return a.Interface().(ast.Node).Pos().Offset - b.Interface().(ast.Node).Pos().Offset
+			})
+			for _, key := range keys {
+				writeTree(out, "Key", key, depth+1)
+				writeTree(out, "Value", value.MapIndex(key), depth+1)
+			}
+		}
+	}
+}
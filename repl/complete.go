@@ -0,0 +1,114 @@
+package repl
+
+import (
+	"interpreter/compiler"
+	"interpreter/object"
+	"interpreter/token"
+	"slices"
+	"strings"
+)
+
+// completer returns the text that could replace line[start:cursor], the part of the word
+// being typed before the cursor, reporting false if the cursor is not in such a word
+type completer func(line []rune, cursor int) (start int, candidates []string, ok bool)
+
+// complete completes a hash's string key after `h["`, and otherwise the names of the
+// session's bindings, built-ins and keywords
+func (s *session) complete(line []rune, cursor int) (int, []string, bool) {
+	if start, name, ok := hashKeyBeingTyped(line, cursor); ok {
+		return start, s.completeHashKey(name, string(line[start:cursor])), true
+	}
+
+	start := cursor
+	for start > 0 && isIdentifierRune(line[start-1]) {
+		start--
+	}
+	if start == cursor {
+		return 0, nil, false
+	}
+
+	prefix := string(line[start:cursor])
+	var candidates []string
+	for _, names := range [][]string{s.bindingNames(), s.interpreter.BuiltInNames(), token.Keywords()} {
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) && !slices.Contains(candidates, name) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	slices.Sort(candidates)
+	return start, candidates, true
+}
+
+// hashKeyBeingTyped reports where the string key after `name["` before the cursor starts
+func hashKeyBeingTyped(line []rune, cursor int) (start int, name string, ok bool) {
+	start = cursor
+	for start > 0 && line[start-1] != '"' {
+		start--
+	}
+	if start < 2 || line[start-2] != '[' {
+		return 0, "", false
+	}
+
+	end := start - 2
+	nameStart := end
+	for nameStart > 0 && isIdentifierRune(line[nameStart-1]) {
+		nameStart--
+	}
+	if nameStart == end {
+		return 0, "", false
+	}
+	return start, string(line[nameStart:end]), true
+}
+
+// completeHashKey returns the string keys of the hash name is bound to that start with
+// prefix, each followed by the `"]` that closes the index
+func (s *session) completeHashKey(name, prefix string) []string {
+	hash, ok := s.binding(name).(*object.Hash)
+	if !ok {
+		return nil
+	}
+
+	var candidates []string
+	for _, pair := range hash.Pairs {
+		if key, ok := pair.Key.(*object.String); ok && strings.HasPrefix(key.Value, prefix) {
+			candidates = append(candidates, key.Value+`"]`)
+		}
+	}
+	slices.Sort(candidates)
+	return candidates
+}
+
+// bindingNames returns the names bound in the session, on either engine
+func (s *session) bindingNames() []string {
+	if s.engine != ENGINE_VM {
+		return s.env.Names()
+	}
+
+	var names []string
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope && s.globals[symbol.Index] != nil {
+			names = append(names, symbol.Name)
+		}
+	}
+	return names
+}
+
+// binding returns the value name is bound to in the session, or nil
+func (s *session) binding(name string) object.Object {
+	if s.engine != ENGINE_VM {
+		value, _ := s.env.Get(name)
+		return value
+	}
+
+	symbol, ok := s.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil
+	}
+	return s.globals[symbol.Index]
+}
+
+// isIdentifierRune matches the lexer's letters, which make up identifiers and keywords
+func isIdentifierRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
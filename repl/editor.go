@@ -0,0 +1,348 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by the editor when Ctrl-C abandons the line being typed
+var errInterrupted = errors.New("interrupted")
+
+// Control keys, as read from a terminal in raw mode
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// editor reads lines from a terminal in raw mode, echoing them itself so the cursor can
+// move within the line and through the history, emacs style:
+//
+//	left, right, Ctrl-B, Ctrl-F   move by a character
+//	Home, End, Ctrl-A, Ctrl-E     move to the start or end of the line
+//	up, down, Ctrl-P, Ctrl-N      recall earlier or later lines from the history
+//	Backspace, Delete, Ctrl-D     delete before or at the cursor
+//	Ctrl-W, Ctrl-U, Ctrl-K        delete the word before, or everything before or after, the cursor
+//	Tab                           complete the word before the cursor, or list the choices
+//	Ctrl-L                        clear the screen
+//	Ctrl-C                        abandon the line
+//	Ctrl-D on an empty line       end the input
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *history
+	complete completer // nil to insert tabs
+}
+
+// lineState is the line being edited
+type lineState struct {
+	prompt string
+	buffer []rune
+	cursor int // index into buffer
+
+	historyIndex int    // of the history line shown, or len(history) for the new line
+	newLine      []rune // the new line, kept while browsing the history
+}
+
+// readLine reads a line after writing prompt, returning errInterrupted for Ctrl-C and
+// io.EOF at the end of the input
+func (e *editor) readLine(prompt string) (string, error) {
+	s := &lineState{prompt: prompt, historyIndex: len(e.history.lines)}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(s.buffer) > 0 {
+				break
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			io.WriteString(e.out, "\r\n")
+			return e.accept(s), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(s.buffer) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.cursor)
+		case keyBackspace, keyCtrlH:
+			if s.cursor > 0 {
+				s.cursor--
+				s.deleteAt(s.cursor)
+			}
+		case keyCtrlA:
+			s.cursor = 0
+		case keyCtrlE:
+			s.cursor = len(s.buffer)
+		case keyCtrlB:
+			s.moveBy(-1)
+		case keyCtrlF:
+			s.moveBy(1)
+		case keyCtrlK:
+			s.buffer = s.buffer[:s.cursor]
+		case keyCtrlU:
+			s.buffer = s.buffer[s.cursor:]
+			s.cursor = 0
+		case keyCtrlW:
+			s.deleteWordBefore()
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			e.browseHistory(s, -1)
+		case keyCtrlN:
+			e.browseHistory(s, 1)
+		case keyTab:
+			e.completeWord(s)
+		case keyEscape:
+			e.readEscape(s)
+		default:
+			if unicode.IsPrint(r) {
+				s.insert(r)
+			}
+		}
+
+		e.refresh(s)
+	}
+
+	io.WriteString(e.out, "\r\n")
+	return e.accept(s), nil
+}
+
+// readEscape handles the rest of an escape sequence, as sent by the arrow and editing keys
+func (e *editor) readEscape(s *lineState) {
+	introducer, err := e.in.ReadByte()
+	if err != nil || (introducer != '[' && introducer != 'O') {
+		return
+	}
+
+	// Parameters, such as the 3 of Delete's ESC [ 3 ~, come before the final byte
+	var parameter []byte
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return
+		}
+		if b >= '0' && b <= '9' || b == ';' {
+			parameter = append(parameter, b)
+			continue
+		}
+
+		switch {
+		case b == 'A':
+			e.browseHistory(s, -1)
+		case b == 'B':
+			e.browseHistory(s, 1)
+		case b == 'C':
+			s.moveBy(1)
+		case b == 'D':
+			s.moveBy(-1)
+		case b == 'H', b == '~' && (string(parameter) == "1" || string(parameter) == "7"):
+			s.cursor = 0
+		case b == 'F', b == '~' && (string(parameter) == "4" || string(parameter) == "8"):
+			s.cursor = len(s.buffer)
+		case b == '~' && string(parameter) == "3":
+			s.deleteAt(s.cursor)
+		}
+		return
+	}
+}
+
+// completeWord completes the word before the cursor as far as all its completions agree,
+// listing them below the line if that adds nothing
+func (e *editor) completeWord(s *lineState) {
+	if e.complete == nil {
+		s.insert('\t')
+		return
+	}
+	start, candidates, ok := e.complete(s.buffer, s.cursor)
+	if !ok {
+		s.insert('\t')
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		prefix = commonPrefix(prefix, []rune(candidate))
+	}
+
+	typed := s.cursor - start
+	if len(prefix) > typed {
+		s.buffer = append(s.buffer[:start:start], append(prefix, s.buffer[s.cursor:]...)...)
+		s.cursor = start + len(prefix)
+		return
+	}
+	if len(candidates) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func commonPrefix(a, b []rune) []rune {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+// browseHistory replaces the line with the one delta lines later in the history
+func (e *editor) browseHistory(s *lineState, delta int) {
+	index := s.historyIndex + delta
+	if index < 0 || index > len(e.history.lines) {
+		return
+	}
+	if s.historyIndex == len(e.history.lines) {
+		s.newLine = s.buffer
+	}
+
+	s.historyIndex = index
+	if index == len(e.history.lines) {
+		s.buffer = s.newLine
+	} else {
+		s.buffer = []rune(e.history.lines[index])
+	}
+	s.cursor = len(s.buffer)
+}
+
+// accept adds the finished line to the history
+func (e *editor) accept(s *lineState) string {
+	line := string(s.buffer)
+	e.history.add(line)
+	return line
+}
+
+// refresh redraws the line, leaving the terminal's cursor at the editing cursor
+func (e *editor) refresh(s *lineState) {
+	io.WriteString(e.out, "\r"+s.prompt+string(s.buffer)+"\x1b[K")
+	if back := displayWidth(s.buffer[s.cursor:]); back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// displayWidth is the number of terminal columns the runes take up
+func displayWidth(runes []rune) int {
+	width := 0
+	for _, r := range runes {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// wideRanges are the East Asian wide and fullwidth blocks, and the emoji, which take up
+// two columns of a terminal
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo initial consonants
+	{0x231A, 0x231B},   // watch, hourglass
+	{0x23E9, 0x23EC},   // media controls
+	{0x23F0, 0x23F3},   // alarm clock, hourglass
+	{0x25FD, 0x25FE},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac signs
+	{0x26AA, 0x26AB},   // circles
+	{0x26BD, 0x26BE},   // soccer ball, baseball
+	{0x26C4, 0x26C5},   // snowman, sun behind cloud
+	{0x26F2, 0x26F5},   // fountain to sailboat
+	{0x2705, 0x2705},   // check mark
+	{0x270A, 0x270B},   // raised fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274C, 0x274C},   // cross mark
+	{0x2753, 0x2755},   // question and exclamation marks
+	{0x2795, 0x2797},   // heavy plus, minus and division
+	{0x2B1B, 0x2B1C},   // large squares
+	{0x2B50, 0x2B50},   // star
+	{0x2E80, 0x303E},   // CJK radicals and punctuation
+	{0x3041, 0x33FF},   // kana, Bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xA960, 0xA97F},   // Hangul Jamo extended A
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x16FE0, 0x18CFF}, // Tangut, Khitan
+	{0x1B000, 0x1B2FF}, // kana supplement and extensions, Nushu
+	{0x1F004, 0x1F004}, // mahjong tile
+	{0x1F0CF, 0x1F0CF}, // playing card
+	{0x1F18E, 0x1F18E}, // AB button
+	{0x1F191, 0x1F19A}, // squared words
+	{0x1F200, 0x1F2FF}, // enclosed ideographic supplement
+	{0x1F300, 0x1F64F}, // pictographs, emoticons
+	{0x1F680, 0x1F6FF}, // transport and map symbols
+	{0x1F7E0, 0x1F7EB}, // colored circles and squares
+	{0x1F900, 0x1F9FF}, // supplemental symbols and pictographs
+	{0x1FA70, 0x1FAFF}, // symbols and pictographs extended A
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+// runeWidth is the number of terminal columns r takes up: two for wide characters, none
+// for combining marks and other zero-width characters, and one otherwise
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			break
+		}
+		if r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+func (s *lineState) insert(r rune) {
+	s.buffer = append(s.buffer[:s.cursor], append([]rune{r}, s.buffer[s.cursor:]...)...)
+	s.cursor++
+}
+
+func (s *lineState) deleteAt(index int) {
+	if index < len(s.buffer) {
+		s.buffer = append(s.buffer[:index:index], s.buffer[index+1:]...)
+	}
+}
+
+func (s *lineState) moveBy(delta int) {
+	s.cursor = max(0, min(len(s.buffer), s.cursor+delta))
+}
+
+func (s *lineState) deleteWordBefore() {
+	start := s.cursor
+	for start > 0 && unicode.IsSpace(s.buffer[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(s.buffer[start-1]) {
+		start--
+	}
+	s.buffer = append(s.buffer[:start:start], s.buffer[s.cursor:]...)
+	s.cursor = start
+}
@@ -0,0 +1,95 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The most lines kept in the history, and in its file
+const maxHistory = 1000
+
+// history is the lines typed so far, oldest first, which persist across sessions in a file
+type history struct {
+	lines     []string
+	file      string // empty to keep the history in memory only
+	fileLines int    // how many lines the file holds
+}
+
+// DefaultHistoryFile is ~/.monkey_history, or empty if there is no home directory
+func DefaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory reads the history in file, which need not exist yet
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	if file == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	h.fileLines = len(h.lines)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		h.save()
+	}
+	return h
+}
+
+// add records line, unless it is blank or repeats the previous line, appending it to the
+// file straight away so that it survives a crash. Once the file is full, it is rewritten
+// without its oldest line instead. Failing to write the file only loses history, so it is
+// not reported.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return
+	}
+
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+
+	if h.file == "" {
+		return
+	}
+	if h.fileLines >= maxHistory {
+		h.save()
+		return
+	}
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err == nil {
+		h.fileLines++
+	}
+}
+
+// save replaces the file with the lines kept. It writes a new file and renames it over
+// the old one, so a crash leaves one or the other.
+func (h *history) save() {
+	tmp := h.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, h.file); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	h.fileLines = len(h.lines)
+}
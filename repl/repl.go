@@ -3,46 +3,254 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
 	"interpreter/evaluator"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"interpreter/token"
+	"interpreter/vm"
 	"io"
+	"os"
+	"strings"
 )
 
-const PROMPT = ">> "
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. " // while the input so far is incomplete
+)
+
+type Engine string
+
+const (
+	ENGINE_EVAL Engine = "eval" // the tree-walking evaluator
+	ENGINE_VM   Engine = "vm"   // the bytecode compiler and virtual machine
+)
+
+// Options configures a REPL session
+type Options struct {
+	Engine      Engine
+	HistoryFile string // where the history persists across sessions; empty to not keep it
+}
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	StartWithEngine(in, out, ENGINE_EVAL)
+}
+
+func StartWithEngine(in io.Reader, out io.Writer, engine Engine) {
+	StartWithOptions(in, out, Options{Engine: engine, HistoryFile: DefaultHistoryFile()})
+}
+
+// StartWithOptions runs a session reading input from in. Input spans several lines until
+// its braces, brackets and parentheses are closed. When in is a terminal, lines are edited
+// with the cursor keys and recalled from the history, see editor. Input starting with a
+// colon is a command to the REPL itself, see commands.
+func StartWithOptions(in io.Reader, out io.Writer, options Options) {
+	// Scripts read their input from the same reader as the REPL, so neither loses what
+	// the other has buffered
+	reader := bufio.NewReader(in)
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Stdin = reader
+	interpreter.Stdout = out
+	interpreter.Stderr = out
+
+	s := &session{out: out, engine: options.Engine, interpreter: interpreter}
+	s.reset()
+	lines := newLineReader(in, reader, out, options.HistoryFile, s.complete)
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := lines.readInput()
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			s.runCommand(strings.TrimSpace(input))
 			continue
 		}
-
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
+		if evaluated, ok := s.run("", input); ok && evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// session is the state a REPL keeps between inputs
+type session struct {
+	out         io.Writer
+	engine      Engine
+	interpreter *evaluator.Interpreter
+
+	env *object.Environment
+
+	// State the VM keeps between inputs
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+
+	inputs []string // run without errors so far, for :save
+}
+
+// reset forgets all bindings
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTableFor(s.interpreter)
+	s.inputs = nil
+}
+
+// run evaluates input, which came from filename if it is not empty, and reports whether it
+// did so without errors. Errors are written to the output, and an error object is returned.
+func (s *session) run(filename, input string) (object.Object, bool) {
+	p := parser.New(lexer.NewFile(filename, input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, input, p.ParseErrors())
+		return nil, false
+	}
+
+	evaluated, ok := s.eval(program)
+	if !ok {
+		return nil, false
+	}
+	if err, isError := evaluated.(*object.Error); isError {
+		io.WriteString(s.out, err.Inspect()+"\n")
+		printExcerpt(s.out, input, err.Pos)
+		printIndented(s.out, err.Traceback())
+		return nil, false
+	}
+
+	s.inputs = append(s.inputs, input)
+	return evaluated, true
+}
+
+// eval runs program on the session's engine, reporting failures to compile or run it,
+// which are not Monkey errors
+func (s *session) eval(program *ast.Program) (object.Object, bool) {
+	if s.engine != ENGINE_VM {
+		return s.interpreter.Eval(program, s.env), true
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(s.out, "Compilation failed:\n %s\n", err)
+		return nil, false
+	}
+
+	bytecode := comp.Bytecode()
+	s.constants = bytecode.Constants
+
+	machine := vm.NewWithInterpreter(bytecode, s.globals, s.interpreter)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(s.out, "Executing bytecode failed:\n %s\n", err)
+		return nil, false
+	}
+	return machine.Result(), true
+}
+
+// lineReader reads the REPL's input, through an editor when it comes from a terminal
+type lineReader struct {
+	reader   *bufio.Reader
+	out      io.Writer
+	terminal *os.File // nil when not editing lines
+	editor   *editor
+}
+
+func newLineReader(in io.Reader, reader *bufio.Reader, out io.Writer, historyFile string, complete completer) *lineReader {
+	r := &lineReader{reader: reader, out: out}
+	if f, ok := in.(*os.File); ok {
+		if restore, err := makeRaw(f.Fd()); err == nil {
+			restore()
+			r.terminal = f
+			r.editor = &editor{in: reader, out: out, history: loadHistory(historyFile), complete: complete}
+		}
+	}
+	return r
+}
+
+// readInput reads lines until they make a complete input. At the end of the input, what
+// has been read so far is returned as it is, and only then is the error io.EOF returned.
+func (r *lineReader) readInput() (string, error) {
+	var lines []string
+	prompt := PROMPT
+
+	for {
+		line, err := r.readLine(prompt)
+		if err == errInterrupted {
+			lines, prompt = nil, PROMPT
+			continue
+		}
+		if err != nil {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if !isIncomplete(input) {
+			return input, nil
+		}
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+func (r *lineReader) readLine(prompt string) (string, error) {
+	if r.terminal != nil {
+		if restore, err := makeRaw(r.terminal.Fd()); err == nil {
+			defer restore()
+			return r.editor.readLine(prompt)
+		}
+	}
+
+	io.WriteString(r.out, prompt)
+	line, err := r.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isIncomplete reports whether input needs more lines: it has an unclosed brace, bracket
+// or parenthesis, or ends inside a string, raw string or block comment
+func isIncomplete(input string) bool {
+	depth := 0
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LBRACKET, token.LPAREN:
+			depth++
+		case token.RBRACE, token.RBRACKET, token.RPAREN:
+			depth--
+		case token.ERROR:
+			if strings.HasPrefix(tok.Literal, "unterminated") {
+				return true
+			}
+		}
+	}
+	return depth > 0
+}
+
+func printParserErrors(out io.Writer, source string, errors []*parser.ParseError) {
+	for _, err := range errors {
+		io.WriteString(out, "\t"+err.Error()+"\n")
+		printExcerpt(out, source, err.Pos)
+	}
+}
+
+// printExcerpt quotes the source line pos points into, with a caret under the column
+func printExcerpt(out io.Writer, source string, pos token.Position) {
+	printIndented(out, pos.Excerpt(source))
+}
+
+func printIndented(out io.Writer, text string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		io.WriteString(out, "\t"+line+"\n")
 	}
 }
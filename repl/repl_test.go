@@ -0,0 +1,314 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"interpreter/evaluator"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\nlet s = \"two\nlines\"; len(s)\n"
+
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(input), &out, Options{Engine: engine})
+
+		expected := ">> .. .. >> .. 3\n>> .. 9\n>> "
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=%q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n x }", false},
+		{"[1, 2,", true},
+		{"add(1,", true},
+		{`"unterminated`, true},
+		{`"terminated"`, false},
+		{`"ends with a quote \"`, true},
+		{"`raw\nlines", true},
+		{`"\q"`, false},
+		{"}", false},
+		{"let f = fn() { // }", true},
+		{"/* a /* nested */ comment", true},
+		{"/* a comment */", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if actual := isIncomplete(tt.input); actual != tt.expected {
+			t.Errorf("%q: expected %t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func testEditor(keys string, h *history) ([]string, error) {
+	e := &editor{in: bufio.NewReader(strings.NewReader(keys)), out: io.Discard, history: h}
+
+	var lines []string
+	for {
+		line, err := e.readLine(PROMPT)
+		if err == errInterrupted {
+			lines = append(lines, "<interrupted>")
+			continue
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"abc\r", []string{"abc"}},
+		{"abc\x7f\x7fd\r", []string{"ad"}},
+		{"ac\x1b[Db\r", []string{"abc"}},
+		{"bc\x01a\x05d\r", []string{"abcd"}},
+		{"abc\x1b[H\x1b[3~\r", []string{"bc"}},
+		{"abc\x02\x02\x0b\r", []string{"a"}},
+		{"abc\x02\x15\r", []string{"c"}},
+		{"let x = 1\x17\x17\r", []string{"let x "}},
+		{"one\rtwo\r\x1b[A\x1b[A\r", []string{"one", "two", "one"}},
+		{"one\rtw\x1b[A\x1b[B\x10\x0eo\r", []string{"one", "two"}},
+		{"abc\x03x\r", []string{"<interrupted>", "x"}},
+		{"partial", []string{"partial"}},
+	}
+
+	for _, tt := range tests {
+		lines, err := testEditor(tt.keys, &history{})
+		if err != io.EOF {
+			t.Errorf("%q: expected io.EOF, got=%v", tt.keys, err)
+		}
+		if strings.Join(lines, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%q: expected %q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+
+	// Ctrl-D ends the input on an empty line, and deletes otherwise
+	lines, err := testEditor("ab\x02\x04\r\x04ignored", &history{})
+	if err != io.EOF || strings.Join(lines, "|") != "a" {
+		t.Errorf("expected [a] and io.EOF, got=%q (%v)", lines, err)
+	}
+}
+
+func TestEditorCursorColumns(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string // the cursor movement ending the last redraw
+	}{
+		{"abc\x1b[D\x1b[D", "\x1b[2D"},
+		{"a中文\x1b[D\x1b[D", "\x1b[4D"},
+		{"x😀y\x1b[D\x1b[D", "\x1b[3D"},
+		{"e\u0301z\x1b[D\x1b[D", "\x1b[1D"},
+		{"中\x1b[D\x1b[C", "\x1b[K"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := &editor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: &out, history: &history{}}
+		e.readLine(PROMPT)
+		redraws := strings.Split(out.String(), "\r")
+		if last := redraws[len(redraws)-2]; !strings.HasSuffix(last, tt.expected) {
+			t.Errorf("%q: expected the redraw to end with %q, got=%q", tt.keys, tt.expected, last)
+		}
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+
+	if _, err := testEditor("let x = 1\r\rlet x = 1\rx\r", loadHistory(file)); err != io.EOF {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "let x = 1\nx\n" {
+		t.Errorf("wrong history file. got=%q", data)
+	}
+
+	lines, _ := testEditor("\x1b[A\x1b[A\r", loadHistory(file))
+	if strings.Join(lines, "|") != "let x = 1" {
+		t.Errorf("expected the history of the last session, got=%q", lines)
+	}
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	old := make([]string, maxHistory+10)
+	for i := range old {
+		old[i] = fmt.Sprintf("old %d", i)
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(old, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	readFile := func() []string {
+		t.Helper()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	h := loadHistory(file)
+	if len(h.lines) != maxHistory || h.lines[0] != "old 10" {
+		t.Errorf("expected the last %d lines loaded, got=%d from %q", maxHistory, len(h.lines), h.lines[0])
+	}
+	if lines := readFile(); len(lines) != maxHistory || lines[0] != "old 10" {
+		t.Errorf("expected the file trimmed to %d lines, got=%d from %q", maxHistory, len(lines), lines[0])
+	}
+
+	for i := 0; i < 5; i++ {
+		h.add(fmt.Sprintf("new %d", i))
+	}
+	if len(h.lines) != maxHistory || h.lines[0] != "old 15" || h.lines[maxHistory-1] != "new 4" {
+		t.Errorf("expected the last %d lines kept, got=%d from %q to %q", maxHistory, len(h.lines), h.lines[0], h.lines[len(h.lines)-1])
+	}
+	if lines := readFile(); strings.Join(lines, "\n") != strings.Join(h.lines, "\n") {
+		t.Errorf("expected the file to hold the lines kept, got=%d from %q to %q", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
+
+func testSession(engine Engine, input string) string {
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Engine: engine})
+	return strings.ReplaceAll(out.String(), PROMPT, "")
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.mk")
+
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		input := "let double = fn(x) { x * 2 };\nlet n = double(2);\n1 + true;\n" +
+			":env\n:type n\n:save " + file + "\n:reset\n:env\n:load " + file + "\nn\n"
+		expected := "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN\n\t1 + true;\n\t  ^\n" +
+			"double = %s\nn = 4\n" +
+			"INTEGER\n" +
+			"saved 3 inputs to " + file + "\n" +
+			"environment reset\nno bindings\n" +
+			"loaded " + file + "\n4\n"
+
+		actual := testSession(engine, input)
+		if actual != strings.Replace(expected, "%s", "fn(x) { (x * 2) }", 1) {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=%q", engine, expected, actual)
+		}
+	}
+
+	saved, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "let double = fn(x) { x * 2 };\nlet n = double(2);\nn\n" {
+		t.Errorf("wrong saved session. got=%q", saved)
+	}
+}
+
+func TestInspectionCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens let x = 1;", "1:1    LET        \"let\"\n1:5    IDENT      \"x\"\n1:7    =          \"=\"\n1:9    INT        \"1\"\n1:10   ;          \";\"\n"},
+		{":ast -a + f(1)", "Program\n" +
+			"  Statements[0]: ExpressionStatement\n" +
+			"    Expression: InfixExpression Operator=\"+\"\n" +
+			"      Left: PrefixExpression Operator=\"-\"\n" +
+			"        Right: Identifier Value=\"a\"\n" +
+			"      Right: CallExpression\n" +
+			"        Function: Identifier Value=\"f\"\n" +
+			"        Arguments[0]: IntegerLiteral Value=1\n"},
+		{`:type "a"`, "STRING\n"},
+		{":type let x = 1;", "no value\n"},
+		{":load", "usage: :load <file>\n"},
+		{":bogus", "unknown command :bogus, see :help\n"},
+	}
+
+	for _, tt := range tests {
+		if actual := testSession(ENGINE_EVAL, tt.input+"\n"); actual != tt.expected {
+			t.Errorf("%q: wrong output.\nexpected=%q\ngot=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	if actual := testSession(ENGINE_EVAL, ":time 1 + 1\n"); !strings.HasPrefix(actual, "2\ntook ") {
+		t.Errorf(":time: wrong output. got=%q", actual)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, engine := range []Engine{ENGINE_EVAL, ENGINE_VM} {
+		s := &session{out: io.Discard, engine: engine, interpreter: evaluator.NewInterpreter()}
+		s.reset()
+		s.run("", `let person = {"name": "Ann", "nickname": "A", "age": 3, 1: 2}; let transformer = 1;`)
+
+		tests := []struct {
+			line     string
+			expected []string
+		}{
+			{"trans", []string{"transform", "transformer"}},
+			{"1 + pe", []string{"person"}},
+			{"wh", []string{"while"}},
+			{"ins", []string{"insert"}},
+			{`person["n`, []string{`name"]`, `nickname"]`}},
+			{`person["`, []string{`age"]`, `name"]`, `nickname"]`}},
+			{`nothing["`, nil},
+			{"zzz", nil},
+		}
+
+		for _, tt := range tests {
+			line := []rune(tt.line)
+			_, candidates, ok := s.complete(line, len(line))
+			if !ok || strings.Join(candidates, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("%s: %q: expected %q, got=%q (%t)", engine, tt.line, tt.expected, candidates, ok)
+			}
+		}
+
+		if _, _, ok := s.complete([]rune("1 + "), 4); ok {
+			t.Errorf("%s: expected nothing to complete after a space", engine)
+		}
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	s := &session{out: io.Discard, engine: ENGINE_EVAL, interpreter: evaluator.NewInterpreter()}
+	s.reset()
+	s.run("", `let person = {"name": "Ann"};`)
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"pers\t\r", "person"},
+		{"tra\t([1], fn(x) { x })\r", "transform([1], fn(x) { x })"},
+		{"person[\"n\t\r", `person["name"]`},
+		{"re\t\r", "re"}, // readline, return and reverse share no longer prefix
+		{"\tx\r", "\tx"},
+	}
+
+	for _, tt := range tests {
+		e := &editor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: io.Discard, history: &history{}, complete: s.complete}
+		line, err := e.readLine(PROMPT)
+		if err != nil || line != tt.expected {
+			t.Errorf("%q: expected %q, got=%q (%v)", tt.keys, tt.expected, line, err)
+		}
+	}
+}
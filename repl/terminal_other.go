@@ -0,0 +1,10 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// makeRaw is only implemented on Linux; elsewhere the REPL reads lines without editing them
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
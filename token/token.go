@@ -1,14 +1,28 @@
 package token
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 type TokenType string
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
+	// A malformed literal or comment, such as an unterminated string. The token's
+	// Literal is the error message.
+	ERROR = "ERROR"
+
+	// Only returned by a lexer told to keep comments; see lexer.EmitComments
+	COMMENT = "COMMENT"
+
 	// Identifiers and literals
 	IDENT = "IDENT" // identifier
 	INT   = "INT"
+	FLOAT = "FLOAT"
 
 	// Operators
 	ASSIGN          = "="
@@ -21,6 +35,22 @@ const (
 	SLASH           = "/"
 	MODULUS         = "%"
 
+	// Logical and bitwise operators
+	AND         = "&&"
+	OR          = "||"
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
+	// Compound assignments
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	MODULUS_ASSIGN  = "%="
+
 	// Emojis
 	EMOJI_TREE = "🌴"
 	EMOJI_DINO = "🦖"
@@ -30,6 +60,8 @@ const (
 	// Relations
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
 
@@ -51,28 +83,108 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 
 	STRING   = "STRING"
 	LBRACKET = "["
 	RBRACKET = "]"
 
-	PERIOD = "." // implement object property access ... [1,2].transform(len) etc.
+	PERIOD = "." // method calls, such as [1,2].transform(len), and hash.key
 	COLON  = ":"
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position locates a token in its source. Lines and columns start at 1, columns count
+// runes, and a zero Position means the position is unknown.
+type Position struct {
+	Filename string
+	Offset   int // byte offset into the source
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String formats the position as file:line:col, leaving out the file if there is none
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.Filename
+	}
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// Excerpt returns the source line p points into, with a caret under its column
+func (p Position) Excerpt(source string) string {
+	if !p.IsValid() {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	if p.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[p.Line-1], "\r")
+
+	// Keep tabs in the padding, so the caret lines up however tabs are displayed
+	var padding strings.Builder
+	column := 1
+	for _, symbol := range line {
+		if column >= p.Column {
+			break
+		}
+		if symbol == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+		column++
+	}
+
+	return line + "\n" + padding.String() + "^"
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+}
+
+// Keywords returns the keywords, sorted
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
 }
 
 func LookupIdent(ident string) TokenType {
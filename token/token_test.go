@@ -0,0 +1,34 @@
+package token
+
+import "testing"
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{Filename: "main.mk", Line: 3, Column: 7}, "main.mk:3:7"},
+		{Position{Line: 3, Column: 7}, "3:7"},
+		{Position{}, ""},
+	}
+
+	for _, tt := range tests {
+		if tt.pos.String() != tt.expected {
+			t.Errorf("wrong position string. expected=%q, got=%q", tt.expected, tt.pos.String())
+		}
+	}
+}
+
+func TestPositionExcerpt(t *testing.T) {
+	source := "let x = 5;\n\tx + true;\n"
+
+	expected := "\tx + true;\n\t  ^"
+	excerpt := Position{Line: 2, Column: 4}.Excerpt(source)
+	if excerpt != expected {
+		t.Errorf("wrong excerpt. expected=%q, got=%q", expected, excerpt)
+	}
+
+	if excerpt := (Position{Line: 9, Column: 1}).Excerpt(source); excerpt != "" {
+		t.Errorf("expected no excerpt past the end of the source, got=%q", excerpt)
+	}
+}
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"interpreter/code"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Position returns the source position of the instruction being executed. Once its
+// operands are read ip points past the opcode, so search back to the instruction's start.
+func (f *Frame) Position() token.Position {
+	for ip := f.ip; ip >= 0; ip-- {
+		if pos, ok := f.cl.Fn.Positions[ip]; ok {
+			return pos
+		}
+	}
+	return token.Position{}
+}
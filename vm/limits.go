@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"time"
+)
+
+// The VM applies the Limits of its interpreter as Eval does, failing with the same errors,
+// which no try block catches. It counts the instructions it runs as steps, rather than the
+// nodes Eval evaluates, and only the objects it actually allocates, so the same program
+// may take a different number of either.
+
+// The context is only checked every so many steps, besides on every call
+const stepsPerCancelCheck = 1024
+
+// step counts an instruction about to be run, reporting whether a limit was exceeded
+func (vm *VM) step() bool {
+	vm.steps++
+
+	if vm.limits.MaxSteps > 0 && vm.steps > vm.limits.MaxSteps {
+		vm.exceed(object.STEP_LIMIT_KIND, "step limit of %d exceeded", vm.limits.MaxSteps)
+		return true
+	}
+	return vm.steps%stepsPerCancelCheck == 0 && vm.checkCancelled()
+}
+
+// allocated counts obj, which an instruction just created, against the allocation limits
+func (vm *VM) allocated(obj object.Object) {
+	if vm.limits.MaxAllocations <= 0 && vm.limits.MaxAllocatedBytes <= 0 {
+		return
+	}
+	switch obj.(type) {
+	case nil, *object.Boolean, *object.Null, *object.Error:
+		return
+	}
+
+	vm.objects++
+	vm.bytes += evaluator.SizeOf(obj)
+
+	if vm.limits.MaxAllocations > 0 && vm.objects > vm.limits.MaxAllocations {
+		vm.exceed(object.MEMORY_LIMIT_KIND, "allocation limit of %d objects exceeded", vm.limits.MaxAllocations)
+	} else if vm.limits.MaxAllocatedBytes > 0 && vm.bytes > vm.limits.MaxAllocatedBytes {
+		vm.exceed(object.MEMORY_LIMIT_KIND, "allocation limit of %d bytes exceeded", vm.limits.MaxAllocatedBytes)
+	}
+}
+
+// reserve checks that the byte limit leaves room for a value of the given size before it
+// is made, as Eval does, halting with the limit's error if not, which it returns
+func (vm *VM) reserve(bytes int64) *object.Error {
+	if vm.limits.MaxAllocatedBytes <= 0 || bytes <= vm.limits.MaxAllocatedBytes-vm.bytes {
+		return nil
+	}
+	err := &object.Error{
+		Message: fmt.Sprintf("allocation limit of %d bytes exceeded", vm.limits.MaxAllocatedBytes),
+		Kind:    object.MEMORY_LIMIT_KIND,
+	}
+	vm.abort(err)
+	return err
+}
+
+// checkCancelled halts once the context is done, or the timeout has passed, reporting
+// whether it did
+func (vm *VM) checkCancelled() bool {
+	select {
+	case <-vm.done:
+		if !vm.deadline.IsZero() && !time.Now().Before(vm.deadline) {
+			vm.exceed(object.TIMEOUT_KIND, "timeout of %s exceeded", vm.limits.Timeout)
+		} else if errors.Is(vm.ctx.Err(), context.DeadlineExceeded) {
+			vm.exceed(object.TIMEOUT_KIND, "evaluation cancelled: %s", vm.ctx.Err())
+		} else {
+			vm.exceed(object.CANCELLED_KIND, "evaluation cancelled: %s", vm.ctx.Err())
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// exceed halts with an error of the given kind
+func (vm *VM) exceed(kind string, format string, a ...interface{}) {
+	vm.abort(&object.Error{Message: fmt.Sprintf(format, a...), Kind: kind})
+}
@@ -0,0 +1,744 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"time"
+)
+
+const (
+	StackSize   = 2048 // the slots the stack starts with; it grows as calls nest deeper
+	GlobalsSize = 65536
+)
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtIns    []object.Object
+	interpreter *evaluator.Interpreter // for looking up built-ins and methods
+
+	stack []object.Object
+	sp    int // always points to the next free slot; the top of the stack is stack[sp-1]
+
+	frames       []*Frame
+	framesIndex  int
+	maxCallDepth int // as in limits, counting the frames above the main one
+
+	handlers []handler // the try blocks being run, innermost last
+
+	// The frame count the innermost run stops at: 0 for Run, more while a built-in calls
+	// back into a function. An error no handler above it catches is returned there as thrown.
+	depth  int
+	thrown *object.Error
+
+	// The value of the most recent top-level statement, or the error that halted the VM
+	result object.Object
+
+	// What the run may use, from the interpreter, and has used so far; see limits.go
+	ctx      context.Context
+	done     <-chan struct{} // ctx.Done(), which is nil if ctx cannot be cancelled
+	limits   evaluator.Limits
+	steps    int64
+	objects  int64
+	bytes    int64
+	deadline time.Time
+}
+
+// handler is where an error raised in a try block resumes execution
+type handler struct {
+	framesIndex int // of the frame running the try block
+	catchIP     int
+	sp          int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return newVM(bytecode, evaluator.NewInterpreter())
+}
+
+func newVM(bytecode *compiler.Bytecode, in *evaluator.Interpreter) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	maxCallDepth := in.Limits.MaxCallDepth
+	if maxCallDepth == 0 {
+		maxCallDepth = evaluator.DefaultMaxCallDepth
+	}
+
+	vm := &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		frames:       []*Frame{mainFrame},
+		framesIndex:  1,
+		maxCallDepth: maxCallDepth,
+
+		interpreter: in,
+		limits:      in.Limits,
+	}
+
+	return vm
+}
+
+// NewWithGlobalsStore keeps global bindings across runs, as the REPL needs
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// NewWithInterpreter is NewWithGlobalsStore for bytecode compiled against the built-ins of
+// in, using a symbol table from compiler.NewSymbolTableFor
+func NewWithInterpreter(bytecode *compiler.Bytecode, s []object.Object, in *evaluator.Interpreter) *VM {
+	vm := newVM(bytecode, in)
+	vm.globals = s
+	return vm
+}
+
+// loadBuiltIns makes the built-ins of the interpreter available, indexed like the compiler
+// does, with those that block bound to ctx
+func (vm *VM) loadBuiltIns(ctx context.Context) {
+	in := vm.interpreter
+	vm.builtIns = vm.builtIns[:0]
+	for _, name := range in.BuiltInNames() {
+		builtIn, _ := in.BindBuiltIn(ctx, vm.reserve, name)
+		if in.TakesCallbacks(name) {
+			builtIn = vm.wrapCallbacks(builtIn)
+		}
+		vm.builtIns = append(vm.builtIns, builtIn)
+	}
+}
+
+// Result returns what Eval would have returned for the same program
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is Run, halting with an error once ctx is done, as EvalContext does. The
+// interpreter's Limits apply too, including its timeout.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if vm.limits.Timeout > 0 {
+		vm.deadline = time.Now().Add(vm.limits.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, vm.deadline)
+		defer cancel()
+	}
+	vm.ctx, vm.done = ctx, ctx.Done()
+	vm.loadBuiltIns(ctx)
+
+	return vm.run(0)
+}
+
+// run executes instructions until the frame stack shrinks to depth, or the VM halts. As
+// in Eval, a panic is thrown as an error from the instruction that caused it, so a bug in
+// the interpreter does not take down a program embedding it.
+func (vm *VM) run(depth int) error {
+	for {
+		panicked, err := vm.execute(depth)
+		if !panicked {
+			return err
+		}
+	}
+}
+
+// execute runs instructions like run, stopping early if one panics
+func (vm *VM) execute(depth int) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// a built-in may panic on the error a callback halted the VM with, which stands
+			if !vm.halted() {
+				vm.throw(&object.Error{Message: fmt.Sprintf("internal error: %v", r), Kind: object.INTERNAL_ERROR_KIND})
+			}
+			panicked = true
+		}
+	}()
+
+	for vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+
+		if frame.ip >= len(ins)-1 {
+			// Only the main program can run off its end; functions always return
+			vm.framesIndex = 0
+			return false, nil
+		}
+
+		if vm.step() {
+			continue
+		}
+
+		frame.ip++
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			value := vm.pop()
+			if vm.framesIndex == 1 {
+				vm.result = value
+			}
+
+		case code.OpInfix:
+			operator := code.InfixOperators[code.ReadUint8(ins[ip+1:])]
+			frame.ip += 1
+			right := vm.pop()
+			left := vm.pop()
+			if vm.reserve(evaluator.InfixSize(operator, left, right)) != nil {
+				continue
+			}
+			vm.pushAllocated(evaluator.ApplyInfix(operator, left, right))
+
+		case code.OpPrefix:
+			operator := code.PrefixOperators[code.ReadUint8(ins[ip+1:])]
+			frame.ip += 1
+			vm.pushAllocated(evaluator.ApplyPrefix(operator, vm.pop()))
+
+		case code.OpTrue:
+			vm.push(evaluator.TRUE)
+		case code.OpFalse:
+			vm.push(evaluator.FALSE)
+		case code.OpNull:
+			vm.push(evaluator.NULL)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if evaluator.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			value := vm.globals[globalIndex]
+			if value == nil {
+				vm.throw(newError("identifier not found: %s", vm.globalNames[globalIndex]))
+				continue
+			}
+			vm.push(value)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if value == nil {
+				vm.throw(newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex]))
+				continue
+			}
+			vm.push(value)
+
+		case code.OpGetBuiltIn:
+			builtInIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.builtIns[builtInIndex])
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			value := frame.cl.Free[freeIndex]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if value == nil {
+				vm.throw(newError("identifier not found: %s", frame.cl.Fn.FreeNames[freeIndex]))
+				continue
+			}
+			vm.push(value)
+
+		case code.OpCurrentClosure:
+			vm.push(frame.cl)
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if vm.globals[globalIndex] == nil {
+				vm.throw(newError("identifier not found: %s", vm.globalNames[globalIndex]))
+				continue
+			}
+			vm.globals[globalIndex] = vm.stack[vm.sp-1]
+
+		case code.OpAssignLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				slot = &cell.Value
+			}
+			if *slot == nil {
+				vm.throw(newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex]))
+				continue
+			}
+			*slot = vm.stack[vm.sp-1]
+
+		case code.OpAssignFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			// the compiler only assigns to free variables captured as cells
+			cell := frame.cl.Free[freeIndex].(*object.Cell)
+			if cell.Value == nil {
+				vm.throw(newError("identifier not found: %s", frame.cl.Fn.FreeNames[freeIndex]))
+				continue
+			}
+			cell.Value = vm.stack[vm.sp-1]
+
+		case code.OpAssignIndex:
+			operator := code.AssignOperators[code.ReadUint8(ins[ip+1:])]
+			frame.ip += 1
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			if vm.limits.MaxAllocatedBytes > 0 && vm.reserve(evaluator.IndexAssignmentSize(operator, left, index, value)) != nil {
+				continue
+			}
+			vm.pushAllocated(evaluator.ApplyIndexAssignment(operator, left, index, value))
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			// The first capture moves the local into a cell, which the slot then refers to
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			vm.push(cell)
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			vm.pushAllocated(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			keys := []object.Object{}
+			values := []object.Object{}
+			for i := vm.sp - numElements; i < vm.sp; i += 2 {
+				keys = append(keys, vm.stack[i])
+				values = append(values, vm.stack[i+1])
+			}
+			vm.sp = vm.sp - numElements
+			vm.pushAllocated(evaluator.BuildHash(keys, values))
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			vm.pushResult(evaluator.ApplyIndex(left, index))
+
+		case code.OpSlice:
+			step, end, start := vm.pop(), vm.pop(), vm.pop()
+			left := vm.pop()
+			if vm.limits.MaxAllocatedBytes > 0 && vm.reserve(evaluator.SliceSize(left, start, end, step)) != nil {
+				continue
+			}
+			vm.pushAllocated(evaluator.ApplySlice(left, start, end, step))
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			vm.executeCall(numArgs)
+
+		case code.OpCallMethod:
+			name := vm.constants[code.ReadUint16(ins[ip+1:])].(*object.String).Value
+			numArgs := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			vm.callMethod(name, int(numArgs))
+
+		case code.OpReturnValue:
+			vm.returnFromFrame(vm.pop())
+
+		case code.OpReturn:
+			vm.returnFromFrame(evaluator.NULL)
+
+		case code.OpClosure:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			vm.pushClosure(constIndex, numFree)
+
+		case code.OpIterator:
+			vm.pushResult(evaluator.Iterate(vm.pop()))
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVariables := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			key, value, ok := vm.stack[vm.sp-1].(*object.Iterator).Next()
+			if !ok {
+				frame.ip = pos - 1
+				continue
+			}
+			if numVariables == 2 {
+				vm.push(key)
+			}
+			vm.push(value)
+
+		case code.OpTry:
+			catchIP := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, catchIP: catchIP, sp: vm.sp})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCatch:
+			vm.stack[vm.sp-1] = evaluator.CaughtValue(vm.stack[vm.sp-1].(*object.Error))
+
+		case code.OpThrow:
+			vm.throw(evaluator.Thrown(vm.pop()))
+
+		case code.OpClearResult:
+			vm.result = nil
+
+		default:
+			return false, fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+
+	return false, nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) {
+	vm.growStack(vm.sp + 1)
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+// growStack makes room for size slots on the stack
+func (vm *VM) growStack(size int) {
+	if size > len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, max(size, 2*len(vm.stack))-len(vm.stack))...)
+	}
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// pushResult pushes the result of an operation, throwing it instead if it is an error
+func (vm *VM) pushResult(o object.Object) {
+	if err, ok := o.(*object.Error); ok {
+		vm.throw(err)
+		return
+	}
+	vm.push(o)
+}
+
+// pushAllocated pushes the result of an operation like pushResult, counting it against the
+// allocation limits
+func (vm *VM) pushAllocated(o object.Object) {
+	vm.pushResult(o)
+	vm.allocated(o)
+}
+
+// throw unwinds to the innermost try block, or halts if there is none, just as errors
+// propagate in Eval
+func (vm *VM) throw(err *object.Error) {
+	if !err.Pos.IsValid() && !vm.halted() {
+		err.Pos = vm.currentFrame().Position()
+	}
+
+	if n := len(vm.handlers); n > 0 && vm.handlers[n-1].framesIndex > vm.depth {
+		h := vm.handlers[n-1]
+		vm.handlers = vm.handlers[:n-1]
+
+		vm.recordStack(err, h.framesIndex)
+		vm.framesIndex = h.framesIndex
+		vm.sp = h.sp
+		vm.push(err)
+		vm.currentFrame().ip = h.catchIP - 1
+		return
+	}
+
+	vm.recordStack(err, vm.depth)
+	if vm.depth == 0 {
+		vm.halt(err)
+		return
+	}
+	// Handlers below depth belong to code waiting on a built-in, which must see the error
+	// first; see callFunction
+	vm.thrown = err
+	vm.framesIndex = vm.depth
+}
+
+// abort halts with err, an exceeded limit, which unlike other errors no try block catches
+func (vm *VM) abort(err *object.Error) {
+	if !vm.halted() {
+		err.Pos = vm.currentFrame().Position()
+		vm.recordStack(err, 0)
+	}
+	vm.halt(err)
+}
+
+// recordStack adds the calls err unwinds through to its stack, as Eval does: those of the
+// frames from the current one down to, but not including, the frame at framesIndex
+func (vm *VM) recordStack(err *object.Error, framesIndex int) {
+	for i := vm.framesIndex - 1; i >= framesIndex && i > 0; i-- {
+		frame := object.StackFrame{Function: vm.frames[i].cl.Fn.Name}
+		// The frame at depth was called by a built-in, from Go code
+		if i != vm.depth {
+			frame.CallPos = vm.frames[i-1].Position()
+		}
+		err.Stack = append(err.Stack, frame)
+	}
+}
+
+// halt stops execution entirely, with result as the program's value
+func (vm *VM) halt(result object.Object) {
+	vm.result = result
+	vm.framesIndex = 0
+}
+
+func (vm *VM) halted() bool {
+	return vm.framesIndex == 0
+}
+
+func (vm *VM) returnFromFrame(value object.Object) {
+	if vm.framesIndex == 1 {
+		// A top-level return ends the program with its value
+		vm.halt(value)
+		return
+	}
+
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	vm.push(value)
+}
+
+func (vm *VM) executeCall(numArgs int) {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		vm.callClosure(callee, numArgs)
+	case *object.BuiltIn:
+		vm.callBuiltIn(callee, numArgs)
+	default:
+		vm.throw(newError("not a function: %s", callee.Type()))
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) {
+	if numArgs < cl.Fn.NumParameters {
+		vm.throw(newError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs))
+		return
+	}
+	if vm.checkCancelled() {
+		return
+	}
+	if vm.framesIndex > vm.maxCallDepth {
+		vm.abort(&object.Error{
+			Message: fmt.Sprintf("maximum call depth of %d exceeded", vm.maxCallDepth),
+			Kind:    object.CALL_DEPTH_LIMIT_KIND,
+		})
+		return
+	}
+
+	// Surplus arguments are ignored, as in Eval
+	vm.sp -= numArgs - cl.Fn.NumParameters
+
+	basePointer := vm.sp - cl.Fn.NumParameters
+	vm.growStack(basePointer + cl.Fn.NumLocals)
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+}
+
+func (vm *VM) callBuiltIn(builtIn *object.BuiltIn, numArgs int) {
+	// The built-in itself is below its arguments, and is replaced by the result too
+	vm.applyBuiltIn(builtIn, vm.sp-numArgs, vm.sp-numArgs-1)
+}
+
+// callMethod calls the method name of the receiver below the arguments, which it gets as
+// its first argument
+func (vm *VM) callMethod(name string, numArgs int) {
+	receiver := vm.stack[vm.sp-numArgs-1]
+	method, takesCallbacks, ok := vm.interpreter.BindMethod(vm.ctx, vm.reserve, receiver, name)
+	if !ok {
+		vm.throw(newError("undefined method %s for %s", name, receiver.Type()))
+		return
+	}
+	if takesCallbacks {
+		method = vm.wrapCallbacks(method)
+	}
+	vm.applyBuiltIn(method, vm.sp-numArgs-1, vm.sp-numArgs-1)
+}
+
+// applyBuiltIn calls builtIn with the arguments from stack[argsStart:sp], replacing
+// everything from stack[base] up with its result
+func (vm *VM) applyBuiltIn(builtIn *object.BuiltIn, argsStart, base int) {
+	args := make([]object.Object, vm.sp-argsStart)
+	copy(args, vm.stack[argsStart:vm.sp])
+
+	var result object.Object
+	if builtIn.CallbackFn != nil {
+		result = builtIn.CallbackFn(vm.callFunction, args...)
+	} else {
+		result = builtIn.Fn(args...)
+	}
+	if vm.halted() || vm.checkCancelled() {
+		return
+	}
+	vm.sp = base
+
+	if result == nil {
+		result = evaluator.NULL
+	}
+	vm.pushAllocated(result)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		vm.throw(newError("not a function: %+v", vm.constants[constIndex]))
+		return
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	vm.pushAllocated(&object.Closure{Fn: function, Free: free})
+}
+
+// callFunction runs fn to completion on behalf of Go code, such as a built-in, and
+// returns its value, or the error it raised
+func (vm *VM) callFunction(fn object.Object, args []object.Object) object.Object {
+	depth := vm.framesIndex
+	sp := vm.sp
+
+	outerDepth := vm.depth
+	vm.depth = depth
+	defer func() { vm.depth = outerDepth }()
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.executeCall(len(args))
+
+	if err := vm.run(depth); err != nil {
+		vm.halt(newError("%s", err))
+	}
+	if vm.halted() {
+		return vm.result
+	}
+	if vm.thrown != nil {
+		err := vm.thrown
+		vm.thrown = nil
+		vm.sp = sp
+		return err
+	}
+	return vm.pop()
+}
+
+// wrapCallbacks lets an evaluator built-in call compiled functions: Closure arguments
+// are handed to it as built-ins that run the closure on this VM
+func (vm *VM) wrapCallbacks(builtIn *object.BuiltIn) *object.BuiltIn {
+	return &object.BuiltIn{
+		Fn: func(args ...object.Object) object.Object {
+			wrapped := make([]object.Object, len(args))
+			for i, arg := range args {
+				if cl, ok := arg.(*object.Closure); ok {
+					wrapped[i] = &object.BuiltIn{
+						Fn: func(args ...object.Object) object.Object {
+							return vm.callFunction(cl, args)
+						},
+					}
+				} else {
+					wrapped[i] = arg
+				}
+			}
+			return builtIn.Fn(wrapped...)
+		},
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: object.RUNTIME_ERROR_KIND}
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
@@ -0,0 +1,648 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRun(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return machine.Result()
+}
+
+func testEval(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+// Every input here is run by both engines, and must produce the same object
+func TestSameResultsAsEval(t *testing.T) {
+	inputs := []string{
+		// integers
+		"5;", "-10;", "5 + 5 + 5 + 5 - 10;", "2 * 2 * 2 * 2 * 2;", "-50 + 100 + -50;",
+		"20 + 2 * -10;", "50 / 2 * 2 + 10;", "3 * (3 * 3) + 10;", "(5 + 10 * 2 + 15 / 3) * 2 + -10;",
+
+		// booleans and negation
+		"true;", "false;", "1 < 2;", "1 > 2;", "1 == 1;", "1 != 10;", "true == false;",
+		"true != false;", "(1 < 2) == true;", "(1 > 2) == false;",
+		"!true;", "!false;", "!5;", "!!true;", "!!5;", "!!!true;",
+
+		// conditionals
+		"if (true) {10};", "if (false) {10};", "if (1) {10};", "if (1 > 2) {10};",
+		"if (1 > 2) {10} else {20};", "if (1 < 2) {10} else {20};",
+
+		// return statements
+		"return 10;", "return 10; 9;", "return 2 * 5; 9;", "9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; };",
+
+		// errors
+		"5 + true;", "5 + true; 5;", "-true;", "true + false;", "5; true + false; 5;",
+		"if (10 > 1) { true + false; }",
+		"if (10 > 1) { if (10 > 1) { return true + false; } return 1; };",
+		"foobar;", `"Hello" - "World";`, `{"name": "Monkey"}[fn(x) {x;}];`,
+
+		// let statements and bindings
+		"let a = 5; a;", "let a = 5 * 5; a;", "let a = 5; let b = a; b;",
+		"let a = 5; let b = a; let c = a + b + 5; c;", "let a = 5;", "let a = 1; let a = a + 1; a;",
+
+		// functions and closures
+		"let identity = fn(x) { x; }; identity(5);", "let identity = fn(x) { return x; }; identity(5);",
+		"let double = fn(x) { x * 2; }; double(5);", "let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) {x;}(5);", "let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(2);",
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(15);",
+		"let f = fn() { g(); }; let g = fn() { 3; }; f();",
+		"let outer = fn() { let inner = fn(x) { if (x == 0) { 0 } else { inner(x - 1) } }; inner(3); }; outer();",
+		"let add = fn(x) { x; }; add(1, 2);", "5(1);",
+
+		// strings, arrays, hashes and built-ins
+		`"Hello World!";`, `"Hello " + "World!";`,
+		`len("");`, `len("four");`, `len(1);`, `len("one", "two");`,
+		"[1, 2 * 2, 3 + 3];", "[1, 2, 3][0];", "[1, 2, 3][3];", "[1, 2, 3][-1];", "[1, 2, 3][-4];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i];",
+		`{"foo": 5}["foo"];`, `{"foo": 5}["bar"];`, `let key = "foo"; {"foo": 5}[key];`, `{}["foo"];`,
+		`{5:5}[5];`, `{true:5}[true];`, `{false:5}[false];`,
+		"push([1], 2);", "concat([1], [2, 3]);", "reverse([1, 2, 3]);", "sort([3, 1, 2]);",
+		"transform([1, 2, 3], fn(x) { x * 2 });", "transform([[1], [1, 2]], len);",
+		"let scale = 3; transform([1, 2], fn(x) { transform([x], fn(y) { y * scale })[0] });",
+
+		// loops
+		"let i = 0; while (i < 10) { let i = i + 1; }; i;", "while (false) { 1; }",
+		"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i;",
+		"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + i; }; n;",
+		"let n = 0; for (i, x in [10, 20, 30]) { let n = n + i * x; }; n;",
+		`let s = ""; for (k, v in {"b": "2", "a": "1"}) { let s = s + k + v; }; s;`,
+		`let n = 0; for (c in "héllo") { let n = n + 1; }; n;`,
+		"let n = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } let n = n + x * y; } }; n;",
+		"let find = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; find([1, 5, 9]);",
+		"let sum = fn(xs) { let n = 0; for (x in xs) { if (x == 2) { continue; } let n = n + x; }; n }; sum([1, 2, 3]);",
+		"for (x in 5) { x; }", "while (true) { 1 + true; }", "for (x in [1]) { x; }",
+
+		// assignments
+		"let x = 1; x = 2; x;", "let x = 1; x = 2;", "let a = 1; let b = 1; a = b = 3; a + b;",
+		"let x = 10; x += 5; x -= 1; x *= 2; x /= 4; x;", `let s = "a"; s += "b"; s;`,
+		"let x = 17; x %= 5; x;", "let x = -7; x %= 3; x;", "let xs = [10, 11]; xs[1] %= 4; xs;", "let x = 1; x %= 0;",
+		"let f = fn() { let n = 10; n %= 4; n }; f();", "let n = 10; let f = fn() { n %= 3; }; f(); n;",
+		"let x = 1; let f = fn() { x = 5; }; f(); x;", "let x = 1; let f = fn() { let x = 2; x = 5; }; f(); x;",
+		"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c();",
+		"let f = fn() { let n = 1; let g = fn() { n }; n = 2; g() }; f();",
+		"let f = fn() { let n = 1; let g = fn() { fn() { n *= 10 } }; g()(); g()(); n }; f();",
+		"let f = fn(n) { let add = fn(x) { n += x }; add(2); add(3); n }; f(1);",
+		"let xs = [1, 2, 3]; xs[0] = 10; xs[-1] += 20; xs;", `let h = {"a": 1}; h["a"] += 1; h["b"] = 5; h;`,
+		"let xs = [1]; let ys = xs; ys[0] = 2; xs[0];", "let i = 0; while (i < 5) { i += 1; }; i;",
+		"x = 1;", "x += 1;", "let x = 1; x += true;", "let xs = [1]; xs[1] = 2;", `let s = "a"; s[0] = "b";`,
+		"let f = fn() { y = 1; }; f();", "let f = fn() { y = 1; }; let y = 0; f(); y;",
+
+		// floats
+		"3.5;", "-2.5;", ".5 + .25;", "2 * 1.5;", "7 / 2.0;", "1e3 + 1;", "1 == 1.0;", "0.5 < 1;",
+		`{1: "one"}[1.0];`, "1.5 + true;", "int(3.99);", "float(3);", "round(2.5);", "floor(-2.1);",
+		"ceil(2.1);", "int(1e300);",
+
+		// big integers
+		"9223372036854775807 + 1;", "-9223372036854775807 - 2;", "9223372036854775807 * 2;",
+		"(9223372036854775807 + 1) - 1;", "100000000000000000000 / 3;", "-100000000000000000000;",
+		"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25);",
+		"100000000000000000000 > 9223372036854775807;", `{100000000000000000000: "big"}[1e20];`,
+		"sort([100000000000000000000, 1, -100000000000000000000]);", "100000000000000000000 + true;",
+
+		// operators
+		"7 % 3;", "-7 % 3;", "7.5 % 2;", "5 % 0;", "2 ** 3 ** 2;", "-2 ** 2;", "2 ** -2;", "2 ** 100;",
+		"1 <= 2;", "3 >= 4;", "2.5 >= 2;", "6 & 3;", "6 | 3;", "6 ^ 3;", "~5;", "1 << 64;", "-16 >> 2;",
+		"1 << -1;", "1.5 & 1;", "let x = 6; x & 1 == 0;", "true && false;", "1 && 2;", `false || "default";`,
+		"false && x;", "true || x;", "false || x;", "if (1 > 2 || 3 > 2) { 10 } else { 20 };",
+		"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n;",
+		"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n;",
+		"let f = fn(x) { x > 0 && x < 10 }; [f(5), f(50)];",
+
+		// methods
+		"[1, 2, 3].first();", "[].last();", "[1, 2, 3].rest();", "[1, 2, 3].contains(2);",
+		"[1, 2, 3].map(fn(x) { x * 2 });", "[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 });",
+		"[1, 2, 3].reduce(fn(sum, x) { sum + x }, 10);", "[].reduce(fn(sum, x) { sum + x });",
+		"let k = 3; [1, 2].map(fn(x) { x * k }).filter(fn(x) { x > 3 });", "[1].map(fn(x) { x + true });",
+		`"héllo".reverse();`, `"a\nb".lines();`, `{"a": 1}.get("b", 0);`, `{"a": 1}.has("a");`,
+		"(-5).abs();", "255.toString(16);", "[1, 2].push(3);", `"four".len();`, `["a", "bb"].transform(len);`,
+		"[1].nope();", "[1].first(2);", "let f = fn(xs) { xs.last() }; f([1, 2]);",
+		`let h = {"name": "Monkey"}; h.name;`, `let h = {"n": 1}; h.n += 1; h.m = 5; [h.n, h.m];`,
+
+		// comparisons
+		`"a" == "a";`, `"a" < "b";`, `"b" >= "abc";`, "[1, 2] == [1, 2];", "[1, [2, 3]] != [1, [2, 3]];",
+		"[1, 2] < [1, 2, 0];", `[1] < ["a"];`, `{"a": 1, "b": [2]} == {"b": [2], "a": 1};`, `1 == "1";`,
+		`sort(["b", "c", "a"]);`, "sort([[2], [1, 5], [1]]);", "sort([{}, {}]);",
+		"let f = fn(x) { x == [1] }; f([1]);", "if ([1] == [1]) { 10 } else { 20 };",
+
+		// slices
+		"[1, 2, 3, 4, 5][1:3];", "[1, 2, 3, 4, 5][::-2];", "[1, 2, 3][-10:];", `"héllo, 世界"[-2:];`, `"héllo"[1];`,
+		"[1, 2, 3][::0];", `[1, 2, 3]["a":];`, "{}[1:2];", "let f = fn(xs, i) { xs[i:] }; f([1, 2, 3], 1);",
+
+		// strings
+		`"a,b".split(",");`, `["a", "é"].join("-");`, `"  x ".trim().upper();`, `"日本語".indexOf("語");`, `"é".repeat(3);`,
+		`"日本".chars();`, `ord("é") + runeLen("日本");`, `format("%s=%05.1f", "x", 2.25);`, `format("%d");`, "chr(-1);",
+		`["a", "b"].map(upper);`,
+
+		// try, catch, finally and throw
+		"try { 1 } catch (e) { 2 };", "try { 1 + true } catch (e) { 2 };", `try { throw "bad"; } catch (e) { e["message"] };`,
+		`try { [1][5] + 1 } catch (e) { e["kind"] };`, `try { len(1) } catch (e) { [e["message"], e["kind"], e["line"]] };`,
+		`try { throw {"message": "m", "kind": "ValueError"}; } catch (e) { e["kind"] + ": " + e["message"] };`,
+		"try { throw 5; } catch { 7 };", "let x = 0; try { x = 1; } finally { x += 10; }; x;",
+		"let x = 0; try { 1 + true; } catch (e) { x = 1; } finally { x += 10; }; x;",
+		"let x = 0; try { throw 1; } finally { x = 5; };", "let x = 0; try { try { throw 1; } finally { x = 5; } } catch { x += 1 }; x;",
+		`try { throw "a"; } catch (e) { throw e; };`, `try { try { 1 + true } catch (e) { throw e; } } catch (e) { e["column"] };`,
+		"let f = fn() { try { return 1; } finally { 2; } }; f();", "let f = fn() { try { 1; } finally { return 2; } }; f();",
+		"let log = []; let f = fn() { try { return 1; } finally { log = push(log, 2); } }; [f(), log];",
+		"let f = fn() { try { throw 1; } catch { return 2; } finally { 3; } }; f();",
+		"let n = 0; for (i in [1, 2, 3]) { try { if (i == 2) { continue; } n += i; } finally { n += 100; } }; n;",
+		"let n = 0; while (true) { try { n += 1; if (n > 3) { break; } } finally { n += 10; } }; n;",
+		"let n = 0; for (i in [1, 2, 3]) { try { throw i; } catch (e) { n += 1; } finally { if (i == 2) { break; } } }; n;",
+		"let n = 0; for (i in [1, 2, 3]) { try { n += i; } finally { continue; } }; n;",
+		"let f = fn(x) { if (x == 0) { throw \"zero\"; } f(x - 1) }; try { f(5) } catch (e) { e[\"message\"] };",
+		"try { transform([1, 2], fn(x) { x + true }) } catch (e) { e[\"message\"] };",
+		"transform([1, 2], fn(x) { x + true });", "throw 1;", `throw "bad";`,
+		"let g = fn() { try { transform([1], fn(x) { throw x; }) } catch (e) { e }; }; g();",
+		"try { 1 } finally { 2 };",
+
+		// operations that used to panic
+		"1 / 0;", "100000000000000000000 / 0;", "pop([]);", "let add = fn(a, b) { a + b }; add(1);",
+		`[1, 2]["a"];`, "insert([1], 5, 2);", `try { 1 / 0 } catch (e) { e["message"] };`,
+
+		// stack traces
+		"let f = fn(x) { x / 0 }; let g = fn() { f(1) }; g();",
+		"let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } }; f(10);",
+		"let g = fn() { transform([1], fn(x) { x + true }) }; g();",
+		"let f = fn() { 1 + true }; let g = fn() { try { f() } finally { 1 } }; g();",
+		`let f = fn() { throw "x" }; let g = fn() { try { f() } catch (e) { throw e } }; g();`,
+		"fn() { fn() { 1 + true }() }();", "let f = fn() { try { 1 + true; } catch (e) { e } }; f();",
+		`if (1 + "a") { "yes" } else { "no" };`, `try { if (1 + "a") { "yes" } else { "no" } } catch (e) { e["message"] };`,
+		`let e = 5; try { throw "x" } catch (e) { 1 }; e;`, `let f = fn() { let e = "5"; try { throw "x" } catch (e) { e["message"] } + e }; f();`,
+		`let x = 1; try { throw "x" } catch { let x = 2; x = 3; }; x;`, `let x = 1; try { throw "x" } catch { x = 2; }; x;`,
+		`try { throw "x" } catch (e) { 1 }; e;`, `try { throw "x" } catch (e) { let g = fn() { e["message"] + h }; }; let h = "!"; g;`,
+		`let g = 0; try { throw "x" } catch (e) { g = fn() { e["message"] + h }; }; let h = "!"; g();`,
+
+		// functions print their source
+		"fn(x) { x + 1 };", "let f = fn(a, b) { let c = a * b; c }; f;", "[fn() { 1 }, len];",
+
+		// recursion deeper than the stack starts out, up to and past the call depth limit
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(9999);",
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10000);",
+		"let f = fn() { f() }; f();", "let f = fn() { f() }; try { f() } catch (e) { 1 };",
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; transform([5000], fn(n) { f(n) });",
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; transform([10000], fn(n) { f(n) });",
+	}
+
+	for _, input := range inputs {
+		expected := testEval(input)
+		actual := testRun(t, input)
+		testSameObject(t, input, expected, actual)
+	}
+}
+
+func testSameObject(t *testing.T, input string, expected, actual object.Object) {
+	t.Helper()
+
+	if expected == nil || actual == nil {
+		if expected != actual {
+			t.Errorf("%q: expected=%v, got=%v", input, expected, actual)
+		}
+		return
+	}
+
+	if expected.Type() != actual.Type() {
+		t.Errorf("%q: wrong type. expected=%s (%s), got=%s (%s)",
+			input, expected.Type(), expected.Inspect(), actual.Type(), actual.Inspect())
+		return
+	}
+
+	switch expected := expected.(type) {
+	case *object.Hash:
+		// Inspect order depends on map iteration, so compare the pairs
+		actual := actual.(*object.Hash)
+		if len(expected.Pairs) != len(actual.Pairs) {
+			t.Errorf("%q: wrong number of pairs. expected=%d, got=%d", input, len(expected.Pairs), len(actual.Pairs))
+		}
+		for key, pair := range expected.Pairs {
+			testSameObject(t, input, pair.Value, actual.Pairs[key].Value)
+		}
+	case *object.Error:
+		if expected.Inspect() != actual.Inspect() {
+			t.Errorf("%q: expected=%s, got=%s", input, expected.Inspect(), actual.Inspect())
+		}
+		expectedTrace, actualTrace := expected.Traceback(), actual.(*object.Error).Traceback()
+		if expectedTrace != actualTrace {
+			t.Errorf("%q: wrong traceback. expected=%q, got=%q", input, expectedTrace, actualTrace)
+		}
+	case *object.Boolean, *object.Null:
+		// the singletons must be shared, since truthiness compares by identity
+		if expected != actual {
+			t.Errorf("%q: expected the evaluator's %s singleton", input, expected.Type())
+		}
+	default:
+		if expected.Inspect() != actual.Inspect() {
+			t.Errorf("%q: expected=%s, got=%s", input, expected.Inspect(), actual.Inspect())
+		}
+	}
+}
+
+func TestClosureIsAFunction(t *testing.T) {
+	result := testRun(t, "fn(x) { x; };")
+	if result.Type() != object.FUNCTION_OBJ {
+		t.Errorf("closures should report FUNCTION, got=%s", result.Type())
+	}
+}
+
+func TestUnboundedRecursionIsAnError(t *testing.T) {
+	result := testRun(t, "let f = fn() { f(); }; f();")
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error, got=%T (%+v)", result, result)
+	}
+	if errObj.Message != "maximum call depth of 10000 exceeded" || errObj.Kind != object.CALL_DEPTH_LIMIT_KIND {
+		t.Errorf("wrong error. got=%q (%s)", errObj.Message, errObj.Kind)
+	}
+}
+
+// identifier returns a distinct name for each i, as identifiers cannot contain digits
+func identifier(i int) string {
+	name := ""
+	for ; ; i = i/26 - 1 {
+		name = string(rune('a'+i%26)) + name
+		if i < 26 {
+			return "v" + name
+		}
+	}
+}
+
+// repeated joins n copies of format, the ith formatted with identifier(i) and i
+func repeated(format string, n int, sep string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = fmt.Sprintf(format, identifier(i), i)
+	}
+	return strings.Join(parts, sep)
+}
+
+// Operands that would not fit in their instructions are compile errors, rather than
+// wrapping around to the wrong local, constant or jump target
+func TestOperandLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedError string
+	}{
+		{"256 locals", "let f = fn() { " + repeated("let %s = %d;", 256, " ") + " [va, viv] }; f();", ""},
+		{"257 locals", "let f = fn() { " + repeated("let %s = %d;", 257, " ") + " [va, viw] }; f();", "too many local bindings: at most 256 allowed"},
+		{"255 arguments", "let f = fn() { 1 }; f(" + repeated("%[2]d", 255, ", ") + ");", ""},
+		{"256 arguments", "let f = fn() { 1 }; f(" + repeated("%[2]d", 256, ", ") + ");", "too many arguments: at most 255 allowed"},
+		{"255 free variables", "fn() { " + repeated("let %s = %d;", 255, " ") + " fn() { [" + repeated("%[1]s", 255, ", ") + "] } }()();", ""},
+		{"256 free variables", "fn() { " + repeated("let %s = %d;", 256, " ") + " fn() { [" + repeated("%[1]s", 256, ", ") + "] } }()();", "too many free variables: at most 255 allowed"},
+		{"65536 constants", repeated("%[2]d;", 65536, " "), ""},
+		{"65537 constants", repeated("%[2]d;", 65537, " "), "too many constants: at most 65536 allowed"},
+		{"long jump", "if (true) { " + repeated("%[2]d;", 20000, " ") + " }", "function or program too long: at most 65536 bytes of bytecode allowed"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		err := compiler.New().Compile(program)
+		if tt.expectedError != "" {
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("%s: expected error %q, got=%v", tt.name, tt.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: compiler error: %s", tt.name, err)
+			continue
+		}
+		testSameObject(t, tt.name, testEval(tt.input), testRun(t, tt.input))
+	}
+
+	in := evaluator.NewInterpreter()
+	for i := 0; i < 300; i++ {
+		value := &object.Integer{Value: int64(i)}
+		in.Register(identifier(i), func(args ...object.Object) object.Object { return value })
+	}
+	if result := testRunWith(t, context.Background(), "[va(), vkn()]", in); result.Inspect() != "[0, 299]" {
+		t.Errorf("expected [0, 299] from the first and last of 300 built-ins, got=%s", result.Inspect())
+	}
+}
+
+func TestGlobalsPersistAcrossRuns(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTableWithBuiltIns()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, input := range []string{"let a = 40;", "let add = fn(x) { a + x };", "add(2);"} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.Result()
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 42 {
+		t.Errorf("expected 42, got=%+v", result)
+	}
+}
+
+func TestClosuresShareCapturedVariables(t *testing.T) {
+	input := `
+	let makeAccount = fn(balance) {
+		let deposit = fn(amount) { balance += amount; };
+		let read = fn() { balance };
+		[deposit, read]
+	};
+	let account = makeAccount(10);
+	account[0](5);
+	account[0](7);
+	account[1]();
+	`
+	result := testRun(t, input)
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 22 {
+		t.Errorf("expected 22, got=%+v", result)
+	}
+}
+
+func TestCallDepthLimitIsNotCaught(t *testing.T) {
+	result := testRun(t, `let f = fn() { f(); }; try { f(); } catch (e) { e["message"] } finally { 1 };`)
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Kind != object.CALL_DEPTH_LIMIT_KIND {
+		t.Errorf("expected the call depth limit to halt the program, got=%+v", result)
+	}
+}
+
+func TestPanicsAreThrownAsErrors(t *testing.T) {
+	in := evaluator.NewInterpreter()
+	in.Register("len", func(args ...object.Object) object.Object {
+		panic("boom")
+	})
+
+	program := parser.New(lexer.New(`try { len("x") } catch (e) { e["kind"] + ": " + e["message"] };`)).ParseProgram()
+	comp := compiler.NewWithState(compiler.NewSymbolTableFor(in), []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := NewWithInterpreter(comp.Bytecode(), make([]object.Object, GlobalsSize), in)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	str, ok := machine.Result().(*object.String)
+	if !ok || str.Value != "InternalError: internal error: boom" {
+		t.Errorf("expected the panic to be caught, got=%+v", machine.Result())
+	}
+}
+
+func TestInterpreterBuiltIns(t *testing.T) {
+	in := evaluator.NewInterpreter()
+	in.Remove("print")
+	in.Register("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"double(21);", "42"},
+		{"transform([1, 2], double);", "[2, 4]"},
+		{`len("four");`, "4"},
+		{`print("hello");`, "ERROR: 1:1: identifier not found: print"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		comp := compiler.NewWithState(compiler.NewSymbolTableFor(in), []object.Object{})
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		machine := NewWithInterpreter(comp.Bytecode(), make([]object.Object, GlobalsSize), in)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+		if actual := machine.Result().Inspect(); actual != tt.expected {
+			t.Errorf("%q: expected %s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// testRunLimited runs input in the VM under ctx and the limits of its interpreter
+func testRunLimited(t *testing.T, ctx context.Context, input string, limits evaluator.Limits) object.Object {
+	t.Helper()
+
+	in := evaluator.NewInterpreter()
+	in.Limits = limits
+	return testRunWith(t, ctx, input, in)
+}
+
+// testRunWith runs input on a VM using the built-ins and limits of in
+func testRunWith(t *testing.T, ctx context.Context, input string, in *evaluator.Interpreter) object.Object {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.NewWithState(compiler.NewSymbolTableFor(in), []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+
+	machine := NewWithInterpreter(comp.Bytecode(), make([]object.Object, GlobalsSize), in)
+	if err := machine.RunContext(ctx); err != nil {
+		t.Fatalf("%q: vm error: %s", input, err)
+	}
+	return machine.Result()
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          evaluator.Limits
+		expectedKind    string
+		expectedMessage string
+	}{
+		{"while (true) { }", evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"let f = fn() { f() }; f();", evaluator.Limits{MaxCallDepth: 50}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 50 exceeded"},
+		{"let xs = []; while (true) { xs = push(xs, 1); }", evaluator.Limits{MaxAllocations: 100}, object.MEMORY_LIMIT_KIND, "allocation limit of 100 objects exceeded"},
+		{`let s = "x"; while (true) { s += s; }`, evaluator.Limits{MaxAllocatedBytes: 1 << 20}, object.MEMORY_LIMIT_KIND, "allocation limit of 1048576 bytes exceeded"},
+		{"while (true) { }", evaluator.Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		{"sleep(60000);", evaluator.Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		// exceeding a limit cannot be caught
+		{"try { while (true) { } } catch { 1 }", evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{"try { sleep(60000) } catch { 1 }", evaluator.Limits{Timeout: 10 * time.Millisecond}, object.TIMEOUT_KIND, "timeout of 10ms exceeded"},
+		{"transform([1], fn(x) { while (true) { } });", evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+	}
+
+	for _, tt := range tests {
+		result := testRunLimited(t, context.Background(), tt.input, tt.limits)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got=%T (%+v)", tt.input, result, result)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: expected %s %q, got=%s %q", tt.input, tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+	}
+
+	input := "let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(15);"
+	limits := evaluator.Limits{MaxSteps: 1000000, MaxCallDepth: 100, MaxAllocations: 100000, MaxAllocatedBytes: 1 << 20, Timeout: time.Minute}
+	if result := testRunLimited(t, context.Background(), input, limits); result.Inspect() != "610" {
+		t.Errorf("expected 610 within the limits, got=%s", result.Inspect())
+	}
+}
+
+// As in Eval, an operation making a value as large as its operands ask for fails before
+// making one larger than the byte limit leaves room for
+func TestLimitsReserveBytesFirst(t *testing.T) {
+	in := evaluator.NewInterpreter()
+	in.Limits = evaluator.Limits{MaxAllocatedBytes: 1 << 20}
+
+	// globals made by Go, so not counted against the limit
+	symbolTable := compiler.NewSymbolTableFor(in)
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbolTable.Define("big").Index] = &object.String{Value: strings.Repeat("x", 16<<20)}
+	many := &object.Array{Elements: make([]object.Object, 1<<20)}
+	for i := range many.Elements {
+		many.Elements[i] = evaluator.TRUE
+	}
+	globals[symbolTable.Define("many").Index] = many
+
+	inputs := []string{
+		"big + big", "let s = big; s += big", "let h = {1: big}; h[1] += big", "big[0:]",
+		"many[::-1]", "concat(many, many)", "many.concat(many)",
+		`repeat("x", 1 << 28)`, `"ab".repeat(1 << 28)`, `repeat("ab", 9223372036854775807)`,
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		comp := compiler.NewWithState(symbolTable, []object.Object{})
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		machine := NewWithInterpreter(comp.Bytecode(), globals, in)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := machine.Run()
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			t.Fatalf("%q: vm error: %s", input, err)
+		}
+
+		result := machine.Result()
+		errObj, ok := result.(*object.Error)
+		if !ok || errObj.Kind != object.MEMORY_LIMIT_KIND || errObj.Message != "allocation limit of 1048576 bytes exceeded" {
+			t.Errorf("%q: expected the byte limit to be exceeded, got=%s", input, result.Type())
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+			t.Errorf("%q: allocated %d bytes before failing", input, allocated)
+		}
+	}
+}
+
+func TestGoCallbacksRunUnderLimits(t *testing.T) {
+	tests := []struct {
+		input           string
+		limits          evaluator.Limits
+		expectedKind    string
+		expectedMessage string
+	}{
+		{`go()["each"](1000000, fn(i) { i })`, evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{`try { go()["each"](1000000, fn(i) { i }) } catch (e) { e }`, evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{`go()["check"](fn() { while (true) { } })`, evaluator.Limits{MaxSteps: 1000}, object.STEP_LIMIT_KIND, "step limit of 1000 exceeded"},
+		{`let f = fn(n) { go()["apply"](f, n) }; f(0)`, evaluator.Limits{MaxCallDepth: 50}, object.CALL_DEPTH_LIMIT_KIND, "maximum call depth of 50 exceeded"},
+	}
+
+	for _, tt := range tests {
+		in := evaluator.NewInterpreter()
+		in.Limits = tt.limits
+		funcs, err := in.ToObject(map[string]interface{}{
+			"each": func(n int, f func(int)) {
+				for i := 0; i < n; i++ {
+					f(i)
+				}
+			},
+			"check": func(f func() error) error { return f() },
+			"apply": func(f func(int) int, n int) int { return f(n + 1) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		in.Register("go", func(args ...object.Object) object.Object { return funcs })
+
+		result := testRunWith(t, context.Background(), tt.input, in)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got=%T (%+v)", tt.input, result, result)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: expected %s %q, got=%s %q", tt.input, tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+	}
+
+	in := evaluator.NewInterpreter()
+	double, err := in.ToObject(func(xs []int, f func(int) int) []int {
+		for i, x := range xs {
+			xs[i] = f(x)
+		}
+		return xs
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Register("double", func(args ...object.Object) object.Object { return double })
+	if result := testRunWith(t, context.Background(), "double()([1, 2], fn(x) { x * 2 })", in); result.Inspect() != "[2, 4]" {
+		t.Errorf("expected [2, 4], got=%s", result.Inspect())
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := testRunLimited(t, cancelled, "while (true) { }", evaluator.Limits{})
+	if errObj, ok := result.(*object.Error); !ok || errObj.Kind != object.CANCELLED_KIND {
+		t.Errorf("expected the run to be cancelled, got=%+v", result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result = testRunLimited(t, ctx, "try { sleep(60000) } catch { 1 }", evaluator.Limits{})
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Kind != object.TIMEOUT_KIND || errObj.Message != "evaluation cancelled: context deadline exceeded" {
+		t.Errorf("expected sleep to return at the deadline, got=%+v", result)
+	}
+}